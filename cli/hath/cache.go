@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/mayocream/hath-go/pkg/hath"
+)
+
+const cacheUsage = `Usage: hath cache <import|export|migrate> [flags]
+
+  import   copy files from a Java client's cache directory into the configured storage
+  export   copy files from the configured storage into the Java client's cache layout
+  migrate  copy files from the configured storage into another backend
+
+Files already in destination are skipped, an interrupted run can be resumed by running it again.
+`
+
+// runCache hath cache subcommand
+func runCache(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return errors.New("missing cache command")
+	}
+
+	cmd := args[0]
+	fs := pflag.NewFlagSet("cache "+cmd, pflag.ContinueOnError)
+	cfgFile := fs.StringP("config", "f", "", "config file")
+	dir := fs.String("dir", "", "Java client's cache directory, for import/export")
+	toBackend := fs.String("to-backend", "", "destination backend for migrate, leveldb or filesystem")
+	toDBFile := fs.String("to-db-file", "", "destination leveldb path for migrate")
+	toCacheDir := fs.String("to-cache-dir", "", "destination cache directory for migrate")
+	verify := fs.Bool("verify", true, "check SHA-1 of every file")
+	interval := fs.Int64("progress", 1000, "report progress every n files")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := parseCfg(*cfgFile)
+	if err != nil {
+		return errors.Wrap(err, "load config")
+	}
+	// don't evict files while copying
+	conf := cfg.StorageConf
+	conf.CacheSizeLimit, conf.DiskMinRemainingBytes = 0, 0
+
+	var srcConf, dstConf hath.StorageConf
+	switch cmd {
+	case "import":
+		if *dir == "" {
+			return errors.New("missing --dir")
+		}
+		srcConf = hath.StorageConf{Backend: hath.StorageBackendFilesystem, CacheDir: *dir}
+		dstConf = conf
+	case "export":
+		if *dir == "" {
+			return errors.New("missing --dir")
+		}
+		srcConf = conf
+		dstConf = hath.StorageConf{Backend: hath.StorageBackendFilesystem, CacheDir: *dir}
+	case "migrate":
+		srcConf = conf
+		dstConf = hath.StorageConf{Backend: *toBackend, DBFile: *toDBFile, CacheDir: *toCacheDir}
+		if dstConf.Backend == "" || dstConf.Backend == hath.StorageBackendLevelDB {
+			if dstConf.DBFile == "" || dstConf.DBFile == srcConf.DBFile {
+				return errors.New("--to-db-file must be set to another path")
+			}
+		} else if dstConf.CacheDir == "" || dstConf.CacheDir == srcConf.CacheDir {
+			return errors.New("--to-cache-dir must be set to another path")
+		}
+	default:
+		fs.Usage()
+		return errors.Errorf("unknown cache command: %s", cmd)
+	}
+
+	src, err := hath.NewStorage(srcConf)
+	if err != nil {
+		return errors.Wrap(err, "open source storage")
+	}
+	defer src.Close()
+	dst, err := hath.NewStorage(dstConf)
+	if err != nil {
+		return errors.Wrap(err, "open destination storage")
+	}
+	defer dst.Close()
+
+	fmt.Printf("Cache %s, source files: %v, destination files: %v\n", cmd, src.FileCount(), dst.FileCount())
+	stats, err := hath.MigrateStorage(ctx, src, dst, hath.MigrateOptions{
+		Verify:           *verify,
+		ProgressInterval: *interval,
+		Progress: func(stats hath.MigrateStats) {
+			fmt.Printf("scanned: %v, copied: %v, skipped: %v, invalid: %v, bytes: %v\n",
+				stats.Scanned, stats.Copied, stats.Skipped, stats.Invalid, stats.Bytes)
+		},
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("Interrupted, run the same command again to resume.")
+		}
+		return err
+	}
+
+	fmt.Printf("Cache %s finished, %v files copied.\n", cmd, stats.Copied)
+	return nil
+}
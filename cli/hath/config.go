@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/mayocream/hath-go/pkg/hath"
 	"github.com/mayocream/hath-go/server"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
@@ -66,5 +67,20 @@ func parseCfg(file string) (*server.Config, error) {
 		fmt.Println("Using default db data path: ", conf.DBFile)
 	}
 
+	if conf.DataDir == "" {
+		conf.DataDir = filepath.Join(baseDir, ".hath")
+		fmt.Println("Using default data dir: ", conf.DataDir)
+	}
+
+	if conf.DownloadDir == "" {
+		conf.DownloadDir = filepath.Join(baseDir, "download")
+		fmt.Println("Using default download dir: ", conf.DownloadDir)
+	}
+
+	if conf.Backend == hath.StorageBackendFilesystem && conf.CacheDir == "" {
+		conf.CacheDir = filepath.Join(baseDir, "cache")
+		fmt.Println("Using default cache dir: ", conf.CacheDir)
+	}
+
 	return conf, nil
 }
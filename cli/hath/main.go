@@ -21,21 +21,35 @@ var cfgFile = pflag.StringP("config", "f", "", "config file")
 
 func main() {
 	godotenv.Load()
-	pflag.Parse()
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		if err := runCache(ctx, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "cache: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	pflag.Parse()
+
 	cfg, err := parseCfg(*cfgFile)
 	if err != nil {
 		exit(errors.Wrap(err, "load config"))
 	}
 
-	h, err := hServer.NewHath(*cfg)
+	h, err := hServer.NewHath(ctx, *cfg)
 	if err != nil {
 		exit(errors.Wrap(err, "init hath server"))
 	}
 
+	zap.S().Info("Reconcile cache with static ranges...")
+	if _, err := h.ReconcileCache(ctx, cfg.RehashCache); err != nil {
+		exit(errors.Wrap(err, "reconcile cache"))
+	}
+
 	wg := &sync.WaitGroup{}
 
 	s := fiber.NewServer(h)
@@ -48,9 +62,42 @@ func main() {
 		}
 	}()
 
+	if cfg.AdminAddr != "" {
+		admin := fiber.NewAdminServer(h, s)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := admin.Serve(ctx); err != nil {
+				exit(errors.Wrap(err, "admin server"))
+			}
+		}()
+	}
+
+	if cfg.MetricsAddr != "" {
+		m := fiber.NewMetricsServer(h)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Serve(ctx); err != nil {
+				exit(errors.Wrap(err, "metrics server"))
+			}
+		}()
+	}
+
+	go handleControlSignals(ctx, h)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := h.Run(ctx); err != nil {
+			zap.S().Errorf("Background jobs failed, shutdown: %s", err)
+			stop()
+		}
+	}()
+
 	<-time.After(1 * time.Second)
 	zap.S().Info("Ready to receive requests, notify h@h server.")
-	if err := h.HC.NotifyStarted(); err != nil {
+	if err := h.NotifyStarted(ctx); err != nil {
 		exit(errors.Wrap(err, "notify h@h p2p server when started"))
 	}
 	zap.S().Info("Finished notify h@h server, it's status should be 'Online' on your h@h panel.")
@@ -59,14 +106,21 @@ func main() {
 	zap.S().Info("Graceful shutdown...")
 
 	zap.S().Info("Notify h@h server, it won't accept new connections.")
-	if err := h.HC.NotifyShutdown(); err != nil {
+	// signal context is done already
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := h.HC.NotifyShutdown(shutdownCtx); err != nil {
 		fmt.Fprintf(os.Stderr, "notify h@h p2p server when shutdown: %s", err)
 	}
 	zap.S().Info("Finished notify h@h server, successful shutdown.")
 
-	zap.S().Info("Wait HTTP server to exit...")
+	zap.S().Info("Wait HTTP server and background jobs to exit...")
 	wg.Wait()
 
+	if err := h.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "close hath server: %s", err)
+	}
+
 	zap.S().Info("Hath Exit.")
 }
 
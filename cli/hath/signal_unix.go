@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	hServer "github.com/mayocream/hath-go/server"
+	"go.uber.org/zap"
+)
+
+// handleControlSignals SIGUSR1 to suspend client, SIGUSR2 to resume.
+func handleControlSignals(ctx context.Context, h *hServer.Hath) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigCh:
+			var err error
+			switch sig {
+			case syscall.SIGUSR1:
+				zap.S().Infof("Received %s, suspend client for %s.", sig, h.Config.SuspendDuration)
+				err = h.HC.Suspend(ctx, h.Config.SuspendDuration)
+			case syscall.SIGUSR2:
+				zap.S().Infof("Received %s, resume client.", sig)
+				err = h.HC.Resume(ctx)
+			}
+			if err != nil {
+				zap.S().Errorf("Handle signal %s: %s", sig, err)
+			}
+		}
+	}
+}
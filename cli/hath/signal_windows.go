@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+
+	hServer "github.com/mayocream/hath-go/server"
+)
+
+// handleControlSignals SIGUSR1/SIGUSR2 are not available on windows, use admin api instead.
+func handleControlSignals(ctx context.Context, h *hServer.Hath) {}
@@ -0,0 +1,78 @@
+package hath
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	blacklistInterval = time.Hour
+	// blacklistInitialDelta first fetch after startup, same as the Java client
+	blacklistInitialDelta = 3 * 24 * time.Hour
+)
+
+// blacklist file ids taken down, they must not be served or cached
+type blacklist struct {
+	sync.RWMutex
+
+	files    map[string]struct{}
+	lastSync time.Time
+}
+
+// IsBlacklisted ...
+func (s *Server) IsBlacklisted(fileID string) bool {
+	defer s.blacklist.RUnlock()
+	s.blacklist.RLock()
+
+	_, ok := s.blacklist.files[fileID]
+	return ok
+}
+
+// SyncBlacklist fetch files blacklisted since last sync, then purge them from cache.
+func (s *Server) SyncBlacklist(ctx context.Context) error {
+	now := time.Now()
+	s.blacklist.RLock()
+	delta := blacklistInitialDelta
+	if !s.blacklist.lastSync.IsZero() {
+		// overlap a little to avoid missing entries
+		delta = now.Sub(s.blacklist.lastSync) + time.Minute
+	}
+	s.blacklist.RUnlock()
+
+	fileIDs, err := s.HC.GetBlacklist(ctx, delta)
+	if err != nil {
+		return errors.Wrap(err, "get blacklist")
+	}
+
+	s.blacklist.Lock()
+	if s.blacklist.files == nil {
+		s.blacklist.files = make(map[string]struct{}, len(fileIDs))
+	}
+	for _, fileID := range fileIDs {
+		s.blacklist.files[fileID] = struct{}{}
+	}
+	s.blacklist.lastSync = now
+	s.blacklist.Unlock()
+
+	var purged int
+	for _, fileID := range fileIDs {
+		hv, err := NewHVFileFromFileID(fileID)
+		if err != nil {
+			continue
+		}
+		if err := s.Stor.DeleteHVFile(hv); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			s.logger.With("fileID", fileID).Errorf("Blacklist, purge file: %s", err)
+			continue
+		}
+		purged++
+	}
+
+	s.logger.Infof("Blacklist, %v files blacklisted, %v purged from cache.", len(fileIDs), purged)
+	return nil
+}
@@ -0,0 +1,38 @@
+package hath
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestServer_SyncBlacklist(t *testing.T) {
+	c, fake := testClient(t)
+	stor := testStorage(t)
+	s := testServer()
+	s.HC, s.DL, s.Stor = c, NewDownloader(), stor
+
+	data, hv := testHVData(t)
+	if err := stor.PutHVFile(hv, data); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.SetBlacklist(hv.FileID())
+	if err := s.SyncBlacklist(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsBlacklisted(hv.FileID()) {
+		t.Fatal("file should be blacklisted")
+	}
+	if ok, _ := stor.HasHVFile(hv); ok {
+		t.Fatal("blacklisted file should be purged from cache")
+	}
+
+	_, _, err := s.HandleHV(context.Background(), hv.FileID(), "fileindex=1;xres=org;keystamp="+testKeystamp(hv.FileID()), "1.jpg")
+	var herr *HTTPErr
+	if !errors.As(err, &herr) || herr.Status != http.StatusNotFound {
+		t.Fatalf("blacklisted file should be 404, got: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package hath
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var certRenewFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "hath_cert_renew_failures_total",
+	Help: "Failed attempts to renew TLS certificate before expiry.",
+})
+
+// WatchCertificate renew tls cert before it expires, in case
+//	refresh_certs command from server is missed.
+func (s *Server) WatchCertificate(ctx context.Context) {
+	runPeriodically(ctx, certCheckInterval, func() {
+		notAfter := s.HC.Certificate.NotAfter()
+		// not loaded yet, it's fetched on startup
+		if notAfter.IsZero() || time.Until(notAfter) > certRenewBefore {
+			return
+		}
+		s.logger.With("notAfter", notAfter).Warn("Cert, certificate expires soon, renew it.")
+		if err := s.renewCertificate(ctx, certRenewAttempts, certRetryBaseDelay); err != nil {
+			s.logger.With("notAfter", notAfter).Errorf("Cert, renew certificate failed, node will serve expired cert: %s", err)
+		}
+	})
+}
+
+// renewCertificate refresh cert with retries, delay is doubled after each failure.
+func (s *Server) renewCertificate(ctx context.Context, attempts int, delay time.Duration) error {
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if lastErr = s.RefreshCertificate(ctx); lastErr == nil {
+			s.logger.With("notAfter", s.HC.Certificate.NotAfter()).Info("Cert, certificate renewed.")
+			return nil
+		}
+		certRenewFailures.Inc()
+		if attempt == attempts-1 {
+			break
+		}
+		s.logger.Warnf("Cert, renew attempt %v failed, retry in %s: %s", attempt+1, delay, lastErr)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+	return errors.Wrapf(lastErr, "%v attempts failed", attempts)
+}
@@ -0,0 +1,94 @@
+package hath
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServer_RenewCertificate(t *testing.T) {
+	c, fake := testClient(t)
+	s := testServer()
+	s.HC = c
+
+	fake.SetCertValidity(time.Hour)
+	if err := s.RefreshCertificate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(c.Certificate.NotAfter()) > certRenewBefore {
+		t.Fatal("cert should expire soon")
+	}
+
+	fake.SetCertValidity(30 * 24 * time.Hour)
+	if err := s.renewCertificate(context.Background(), 3, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(c.Certificate.NotAfter()) < certRenewBefore {
+		t.Fatalf("cert should be renewed, not after: %s", c.Certificate.NotAfter())
+	}
+
+	// server can't issue cert, retries exhausted
+	fake.Handle(string(ActionGetCertificate), func(add string) string { return "FAIL" })
+	before := fake.Calls(string(ActionGetCertificate))
+	if err := s.renewCertificate(context.Background(), 3, time.Millisecond); err == nil {
+		t.Fatal("renewal should fail")
+	}
+	if n := fake.Calls(string(ActionGetCertificate)) - before; n != 3 {
+		t.Fatalf("expected 3 attempts, calls: %v", n)
+	}
+}
+
+func TestServer_CertificateStatus(t *testing.T) {
+	c, fake := testClient(t)
+	s := testServer()
+	s.HC, s.Stor, s.GD = c, testStorage(t), NewGalleryDownloader(DownloaderConf{}, c)
+
+	fake.SetCertValidity(time.Hour)
+	if err := s.RefreshCertificate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Status().Certificate.Valid {
+		t.Fatal("cert should be valid")
+	}
+	// validity is checked by server clock, the same as fetched cert
+	atomic.StoreInt64(&c.serverTimeDelta, int64(2*time.Hour/time.Second))
+	if s.Status().Certificate.Valid {
+		t.Fatal("cert should be expired by server time")
+	}
+}
+
+func TestServer_CachedCertificate(t *testing.T) {
+	c, fake := testClient(t)
+	dataDir := t.TempDir()
+	s := testServer()
+	s.HC, s.certCache = c, newCertCache(dataDir, testClientKey)
+
+	if _, err := s.TLSConfig(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fetched, _ := c.Certificate.GetCertificate()
+
+	// restart with rpc server unreachable
+	fake.Handle(string(ActionGetCertificate), func(add string) string { return "FAIL" })
+	c.Certificate.StoreCertificate(nil)
+	if _, err := s.TLSConfig(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.Calls(string(ActionGetCertificate)); n != 1 {
+		t.Fatalf("cached cert should be reused, calls: %v", n)
+	}
+	cached, err := c.Certificate.GetCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cached.Certificate[0], fetched.Certificate[0]) || len(cached.Certificate) != len(fetched.Certificate) {
+		t.Fatal("cached cert mismatch")
+	}
+
+	// cache is sealed with client key
+	if _, err := newCertCache(dataDir, "another-client-key").Load(); err == nil {
+		t.Fatal("cached cert should not be decrypted by another key")
+	}
+}
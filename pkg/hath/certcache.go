@@ -0,0 +1,150 @@
+package hath
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// certCacheFile name of cached cert in data dir
+const certCacheFile = "cert.bin"
+
+// CertConf ...
+type CertConf struct {
+	// DataDir tls cert is cached here encrypted with client key, it's reused
+	//	across restarts while still valid, disabled if empty.
+	DataDir string `mapstructure:"data_dir"`
+}
+
+// certCache tls cert chain and key persisted in data dir, content is
+//	PEM encoded then sealed by AES-GCM with SHA-256 of client key.
+type certCache struct {
+	path string
+	key  [sha256.Size]byte
+}
+
+func newCertCache(dataDir, clientKey string) *certCache {
+	if dataDir == "" {
+		return nil
+	}
+	return &certCache{
+		path: filepath.Join(dataDir, certCacheFile),
+		key:  sha256.Sum256([]byte(clientKey)),
+	}
+}
+
+func (cc *certCache) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cc.key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Load cached cert, os.ErrNotExist is returned if not cached.
+func (cc *certCache) Load() (*tls.Certificate, error) {
+	data, err := os.ReadFile(cc.path)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cc.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("cached cert truncated")
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		// client key is changed or file is corrupted
+		return nil, errors.Wrap(err, "decrypt cached cert")
+	}
+
+	// certs and key are in the same PEM stream, other blocks are skipped
+	cert, err := tls.X509KeyPair(plain, plain)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse cached cert")
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, errors.Wrap(err, "parse cached leaf cert")
+	}
+	return &cert, nil
+}
+
+// Save replace cached cert atomically
+func (cc *certCache) Save(cert *tls.Certificate) error {
+	buf := &bytes.Buffer{}
+	for _, der := range cert.Certificate {
+		if err := pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return err
+		}
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return errors.Wrap(err, "marshal key")
+	}
+	if err := pem.Encode(buf, &pem.Block{Type: "PRIVATE KEY", Bytes: key}); err != nil {
+		return err
+	}
+
+	aead, err := cc.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := aead.Seal(nonce, nonce, buf.Bytes(), nil)
+
+	if err := os.MkdirAll(filepath.Dir(cc.path), 0o700); err != nil {
+		return err
+	}
+	tmp := cc.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cc.path)
+}
+
+// cachedCertificate valid cert from data dir, nil if not available.
+//	renew reports whether it expires soon and should be fetched again.
+func (s *Server) cachedCertificate() (cert *tls.Certificate, renew bool) {
+	if s.certCache == nil {
+		return nil, false
+	}
+	cert, err := s.certCache.Load()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.logger.Warnf("Cert, cached cert ignored: %s", err)
+		}
+		return nil, false
+	}
+	if !time.Now().Before(cert.Leaf.NotAfter) {
+		s.logger.With("notAfter", cert.Leaf.NotAfter).Info("Cert, cached cert expired.")
+		return nil, false
+	}
+	return cert, time.Until(cert.Leaf.NotAfter) <= certRenewBefore
+}
+
+// saveCertificate failure is logged only, cert is fetched next time
+func (s *Server) saveCertificate(cert *tls.Certificate) {
+	if s.certCache == nil {
+		return
+	}
+	if err := s.certCache.Save(cert); err != nil {
+		s.logger.Errorf("Cert, save cert to data dir: %s", err)
+	}
+}
@@ -2,9 +2,9 @@
 package hath
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"net"
 	"net/http"
@@ -17,12 +17,10 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/cloudflare/cfssl/helpers"
 	"github.com/go-resty/resty/v2"
 	"github.com/pkg/errors"
 	"github.com/spf13/cast"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/pkcs12"
 
 	"github.com/mayocream/hath-go/pkg/hath/util"
 	"github.com/mayocream/hath-go/pkg/wrr"
@@ -45,13 +43,121 @@ type RemoteSettings struct {
 	RawSettings map[string]string
 }
 
+// InStaticRange static ranges are identified by first 4 hex chars of file hash.
+func (rs *RemoteSettings) InStaticRange(hash string) bool {
+	if len(hash) < 4 {
+		return false
+	}
+	defer rs.RUnlock()
+	rs.RLock()
+
+	_, ok := rs.StaticRanges[hash[:4]]
+	return ok
+}
+
+// ThrottleBytes outbound bytes per second limit set on h@h panel, 0 means unlimited.
+func (rs *RemoteSettings) ThrottleBytes() int64 {
+	defer rs.RUnlock()
+	rs.RLock()
+
+	return cast.ToInt64(rs.RawSettings["throttle_bytes"])
+}
+
+// MaxConnections derived from throttle_bytes like the Java client,
+//	each 10KB/s bandwidth allows one more connection.
+func (rs *RemoteSettings) MaxConnections() int64 {
+	throttle := rs.ThrottleBytes()
+	if throttle <= 0 {
+		return MaxConnectionCap
+	}
+	if max := MaxConnectionBase + throttle/10000; max < MaxConnectionCap {
+		return max
+	}
+	return MaxConnectionCap
+}
+
 // RPCServers multi-server for rpc call, using weighted round-robin aglo
 //	to load balancing.
 type RPCServers struct {
 	sync.RWMutex
 
 	Hosts    map[string]int
-	Balancer wrr.WRR
+	Balancer *wrr.Latency
+
+	// demoted host => time it's trusted again
+	demoted map[string]time.Time
+}
+
+// Demote skip failing host for d
+func (rs *RPCServers) Demote(host string, d time.Duration) {
+	defer rs.Unlock()
+	rs.Lock()
+
+	if _, ok := rs.Hosts[host]; !ok {
+		return
+	}
+	if rs.demoted == nil {
+		rs.demoted = make(map[string]time.Time)
+	}
+	rs.demoted[host] = time.Now().Add(d)
+}
+
+// Observe feed result of a call to balancer
+func (rs *RPCServers) Observe(host string, latency time.Duration, failed bool) {
+	defer rs.RUnlock()
+	rs.RLock()
+
+	if rs.Balancer != nil {
+		rs.Balancer.Observe(host, latency, failed)
+	}
+}
+
+// SetHosts hosts are updated in place, so stats of existing hosts are kept.
+func (rs *RPCServers) SetHosts(hosts map[string]int) {
+	defer rs.Unlock()
+	rs.Lock()
+
+	if rs.Balancer == nil {
+		rs.Balancer = wrr.NewLatency()
+	}
+	for host := range rs.Hosts {
+		if _, ok := hosts[host]; !ok {
+			rs.Balancer.Remove(host)
+			delete(rs.demoted, host)
+		}
+	}
+	for host, weight := range hosts {
+		rs.Balancer.Add(host, int64(weight))
+	}
+	rs.Hosts = hosts
+}
+
+// healthy number of hosts not demoted
+func (rs *RPCServers) healthy() int {
+	defer rs.RUnlock()
+	rs.RLock()
+
+	n := 0
+	for host := range rs.Hosts {
+		if !rs.isDemoted(host) {
+			n++
+		}
+	}
+	return n
+}
+
+func (rs *RPCServers) isDemoted(host string) bool {
+	until, ok := rs.demoted[host]
+	return ok && time.Now().Before(until)
+}
+
+// IsRPCServer ip belongs to rpc servers
+func (rs *RPCServers) IsRPCServer(ip string) bool {
+	defer rs.RUnlock()
+	rs.RLock()
+
+	_, ok := rs.Hosts[ip]
+	return ok
 }
 
 // RPCResponse general hath response from server
@@ -87,6 +193,24 @@ func (c *Certificate) GetCertificate() (*tls.Certificate, error) {
 	return c.Certificate, nil
 }
 
+// NotAfter expiry of leaf cert, zero time if cert is not available
+func (c *Certificate) NotAfter() time.Time {
+	defer c.mu.RUnlock()
+	c.mu.RLock()
+
+	if c.Certificate == nil || len(c.Certificate.Certificate) == 0 {
+		return time.Time{}
+	}
+	leaf := c.Certificate.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(c.Certificate.Certificate[0]); err != nil {
+			return time.Time{}
+		}
+	}
+	return leaf.NotAfter
+}
+
 // RPCPayload rpc payload data.
 //	There might be 2 forms of respopnse,
 //	1. key and value pairs
@@ -125,13 +249,47 @@ type Client struct {
 	RPCServers RPCServers
 
 	http *resty.Client
+	// rpcBase scheme, host and path of rpc endpoint
+	rpcBase *url.URL
+	// fixedRPCHost rpc servers assigned by h@h server are not used
+	fixedRPCHost bool
+	transport    http.RoundTripper
 
 	serverTimeDelta int64
 	Certificate     *Certificate
+
+	heartbeat  heartbeat
+	suspension suspension
+
+	// lastOverload unix nano of last overload notification
+	lastOverload int64
+
+	// ctx background rpc calls like auto resume are cancelled on shutdown
+	ctx context.Context
+}
+
+// ClientOption ...
+type ClientOption func(c *Client)
+
+// WithRPCBaseURL send rpc calls to u instead of h@h rpc servers,
+//	e.g. http://127.0.0.1:8080/15/rpc, it's used to test with a fake server.
+func WithRPCBaseURL(u *url.URL) ClientOption {
+	return func(c *Client) {
+		base := *u
+		c.rpcBase = &base
+		c.fixedRPCHost = true
+	}
+}
+
+// WithTransport http transport of rpc calls
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.transport = rt
+	}
 }
 
 // NewClient creates new client.
-func NewClient(config Settings) (*Client, error) {
+func NewClient(ctx context.Context, config Settings, opts ...ClientOption) (*Client, error) {
 	if config.ClientID == "" || config.ClientKey == "" {
 		return nil, errors.New("id/key missing")
 	}
@@ -145,21 +303,31 @@ func NewClient(config Settings) (*Client, error) {
 	}
 	c := &Client{
 		Settings: config,
-		http: resty.NewWithClient(&http.Client{
-			Transport: http.DefaultTransport,
-			Timeout:   60 * time.Second,
-		}).SetHeader("Connection", "Close").
-			SetHeader("User-Agent", "Hentai@Home "+ClientVersion).
-			// SetRetryCount(3).
-			EnableTrace().
-			SetDebug(cast.ToBool(os.Getenv("HATH_HTTP_DEBUG"))),
+		rpcBase: &url.URL{
+			Scheme: ClientRPCProtocol,
+			Host:   ClientRPCHost,
+			Path:   ClientRPCFile,
+		},
+		transport:   http.DefaultTransport,
 		Certificate: new(Certificate),
-	}
+		ctx:         ctx,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.http = resty.NewWithClient(&http.Client{
+		Transport: c.transport,
+		Timeout:   60 * time.Second,
+	}).SetHeader("Connection", "Close").
+		SetHeader("User-Agent", "Hentai@Home "+ClientVersion).
+		// SetRetryCount(3).
+		EnableTrace().
+		SetDebug(cast.ToBool(os.Getenv("HATH_HTTP_DEBUG")))
 	// Init
 	zap.S().Info("sync server time delta")
-	c.SyncTimeDelta()
+	c.SyncTimeDelta(ctx)
 	zap.S().Info("fetch remote settings")
-	c.FetchRemoteSettings(false) // not running
+	c.FetchRemoteSettings(ctx, false) // not running
 	return c, nil
 }
 
@@ -176,20 +344,40 @@ var (
 	// ErrClientIDInUse The server detected that another client is already using this client ident.
 	//	If you want to run more than one client, you have to apply for additional idents.
 	ErrClientIDInUse = errors.New("another client is already using this client ident")
+	// ErrTermBadNetwork The server terminated this client for its network is misconfigured.
+	ErrTermBadNetwork = errors.New("client terminated for bad network")
 )
 
-// RPCRawRequest will retry 3 times when failed, then downgrade rpc severs
-//	TODO improve load balancer for less RTT
+var (
+	// ErrKeyExpired request was signed with wrong time
+	ErrKeyExpired = errors.New("key expired")
+	// ErrRPCUnavailable rpc server is unreachable or responds with server error
+	ErrRPCUnavailable = errors.New("rpc server unavailable")
+)
+
+// RPCRawRequest single rpc call without retry
 func (c *Client) RPCRawRequest(uri *url.URL) (*RPCResponse, error) {
-	resp, err := c.http.R().Get(uri.String())
+	return c.rpcRawRequest(context.Background(), uri)
+}
+
+func (c *Client) rpcRawRequest(ctx context.Context, uri *url.URL) (*RPCResponse, error) {
+	resp, err := c.http.R().SetContext(ctx).Get(uri.String())
 	if err != nil {
-		return nil, err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %s", ErrRPCUnavailable, err)
 	}
 	ti := resp.Request.TraceInfo()
+	rpcDuration.WithLabelValues(uri.Query().Get("act"), uri.Host).Observe(ti.TotalTime.Seconds())
 	log := zap.S().Named("Hath-Client").With("url", uri.String(),
 		"totalTime", ti.TotalTime.String(),
 		"connTime", ti.ConnTime.String(),
 		"responseTime", (ti.ServerTime + ti.ResponseTime).String())
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		log.Warnf("HathRPC, http code: %v, server error.", resp.StatusCode())
+		return nil, fmt.Errorf("%w: http code: %v", ErrRPCUnavailable, resp.StatusCode())
+	}
 	if len(resp.Body()) == 0 {
 		log.Warnf("HathRPC, http code: %v, empty body.", resp.StatusCode())
 		return nil, ErrRespIsNull
@@ -210,6 +398,7 @@ func (c *Client) RPCRawRequest(uri *url.URL) (*RPCResponse, error) {
 	}
 
 	if status == "OK" {
+		c.RPCServers.Observe(uri.Host, ti.TotalTime, false)
 		// filter results
 		payload := make([]string, 0, len(split)-1)
 		// avoid out of range
@@ -228,14 +417,7 @@ func (c *Client) RPCRawRequest(uri *url.URL) (*RPCResponse, error) {
 	}
 
 	if status == "KEY_EXPIRED" {
-		// refresh key and retry
-		if err := c.SyncTimeDelta(); err != nil {
-			return nil, errors.Wrap(err, "key expired, retry failed")
-		}
-		if _, err := c.FetchRemoteSettings(true); err != nil {
-			return nil, errors.Wrap(err, "key expired, retry failed")
-		}
-		return c.RPCRawRequest(uri)
+		return nil, ErrKeyExpired
 	}
 
 	if strings.HasPrefix(status, "TEMPORARILY_UNAVAILABLE") {
@@ -251,7 +433,11 @@ func (c *Client) RPCRawRequest(uri *url.URL) (*RPCResponse, error) {
 	}
 
 	if strings.HasPrefix(status, "FAIL_CID_IN_USE") {
-		return nil, ErrIPAddressInUse
+		return nil, ErrClientIDInUse
+	}
+
+	if strings.HasPrefix(status, "TERM_BAD_NETWORK") {
+		return nil, ErrTermBadNetwork
 	}
 
 	return nil, fmt.Errorf("unknown: %s", status)
@@ -262,12 +448,17 @@ func (c *Client) correctedTime() int {
 	return util.SystemTime() + int(atomic.LoadInt64(&c.serverTimeDelta))
 }
 
+// serverTime local clock corrected to server's, it's used to check cert validity
+func (c *Client) serverTime() time.Time {
+	return time.Unix(int64(c.correctedTime()), 0)
+}
+
 // GetRPCURL url query string holds params.
 func (c *Client) GetRPCURL(act Action, add string) *url.URL {
-	u := &url.URL{
-		Scheme: ClientRPCProtocol,
-		Path:   ClientRPCFile,
-		Host:   c.GetRPCHost(),
+	base := *c.rpcBase
+	u := &base
+	if !c.fixedRPCHost {
+		u.Host = c.GetRPCHost()
 	}
 	if act == ActionServerStat {
 		q := make(url.Values, 2)
@@ -283,7 +474,57 @@ func (c *Client) GetRPCURL(act Action, add string) *url.URL {
 
 // RPCRequest general rpc call.
 func (c *Client) RPCRequest(act Action, add string) (*RPCResponse, error) {
-	return c.RPCRawRequest(c.GetRPCURL(act, add))
+	return c.RPCRequestContext(context.Background(), act, add)
+}
+
+// RPCRequestContext rpc call with retries, failing hosts are demoted and the call
+//	fails over to next host immediately, backoff applies when no healthy host left.
+//	Expired key is retried once after clock synced.
+func (c *Client) RPCRequestContext(ctx context.Context, act Action, add string) (*RPCResponse, error) {
+	var lastErr error
+	synced := false
+	delay := rpcRetryBaseDelay
+	for attempt := 0; attempt < rpcMaxAttempts; attempt++ {
+		// url is signed again for each attempt
+		uri := c.GetRPCURL(act, add)
+		resp, err := c.rpcRawRequest(ctx, uri)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, ErrKeyExpired) && !synced && act != ActionServerStat:
+			synced = true
+			if err := c.SyncTimeDelta(ctx); err != nil {
+				return nil, errors.Wrap(err, "key expired, sync time")
+			}
+			continue
+		case errors.Is(err, ErrRPCUnavailable), errors.Is(err, ErrRespIsNull), errors.Is(err, ErrTemporarilyUnavailable):
+			c.RPCServers.Observe(uri.Host, 0, true)
+			c.RPCServers.Demote(uri.Host, rpcDemoteDuration)
+		default:
+			return nil, err
+		}
+
+		if attempt == rpcMaxAttempts-1 {
+			break
+		}
+		if c.fixedRPCHost || c.RPCServers.healthy() == 0 {
+			zap.S().With("act", act, "host", uri.Host).Warnf("HathRPC, retry in %s: %s", delay, err)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		} else {
+			zap.S().With("act", act, "host", uri.Host).Warnf("HathRPC, fail over to next host: %s", err)
+		}
+	}
+	return nil, errors.Wrapf(lastErr, "%v attempts failed", rpcMaxAttempts)
 }
 
 func (c *Client) getURLQuery(act Action, add string) url.Values {
@@ -294,27 +535,33 @@ func (c *Client) getURLQuery(act Action, add string) url.Values {
 	q := make(url.Values, 6)
 	q.Add("clientbuild", strconv.Itoa(ClientBuild))
 	q.Add("act", string(act))
+	q.Add("add", add)
 	q.Add("cid", c.ClientID)
 	q.Add("acttime", strconv.Itoa(correctedTime))
 	q.Add("actkey", actKey)
 	return q
 }
 
-// GetRPCHost wrr load balancer
+// GetRPCHost wrr load balancer, demoted hosts are skipped
+//	unless all hosts are demoted.
 func (c *Client) GetRPCHost() string {
 	defer c.RPCServers.RUnlock()
 	c.RPCServers.RLock()
 
-	if len(c.RPCServers.Hosts) > 0 {
-		return c.RPCServers.Balancer.Next().(string)
+	if len(c.RPCServers.Hosts) == 0 {
+		return ClientRPCHost
 	}
 
-	return ClientRPCHost
+	host := c.RPCServers.Balancer.Next().(string)
+	for i := 1; i < len(c.RPCServers.Hosts) && c.RPCServers.isDemoted(host); i++ {
+		host = c.RPCServers.Balancer.Next().(string)
+	}
+	return host
 }
 
 // SyncTimeDelta sync clock with hath server
-func (c *Client) SyncTimeDelta() error {
-	resp, err := c.RPCRequest(ActionServerStat, "")
+func (c *Client) SyncTimeDelta(ctx context.Context) error {
+	resp, err := c.RPCRequestContext(ctx, ActionServerStat, "")
 	if err != nil {
 		return err
 	}
@@ -337,7 +584,7 @@ func (c *Client) SyncTimeDelta() error {
 }
 
 // FetchRemoteSettings fetch client settings from h@h, priority more than local config
-func (c *Client) FetchRemoteSettings(isRunning bool) (*RPCResponse, error) {
+func (c *Client) FetchRemoteSettings(ctx context.Context, isRunning bool) (*RPCResponse, error) {
 	// action can be different from server side logic,
 	//	though it returns same response.
 	// RAW: this MUST NOT be called after the client has started up,
@@ -347,28 +594,23 @@ func (c *Client) FetchRemoteSettings(isRunning bool) (*RPCResponse, error) {
 	if isRunning {
 		act = ActionClientSettings
 	}
-	resp, err := c.RPCRequest(act, "")
+	resp, err := c.RPCRequestContext(ctx, act, "")
 	if err != nil {
 		return nil, err
 	}
 
 	payloadKvs := resp.Payload.KeyValues()
+	c.settingsRefreshed()
 
 	if srvListStr, ok := payloadKvs["rpc_server_ip"]; ok {
 		srvList := strings.Split(srvListStr, ";")
 		hosts := make(map[string]int, len(srvList))
-		balancer := wrr.NewEDF()
 		for _, srv := range srvList {
 			if srvIP := net.ParseIP(srv); srvIP != nil {
 				hosts[srvIP.String()] = 10
-				balancer.Add(srvIP.String(), 10)
 			}
 		}
-		defer c.RPCServers.Unlock()
-		c.RPCServers.Lock()
-
-		c.RPCServers.Hosts = hosts
-		c.RPCServers.Balancer = balancer
+		c.RPCServers.SetHosts(hosts)
 	}
 
 	defer c.RemoteSettings.Unlock()
@@ -380,21 +622,23 @@ func (c *Client) FetchRemoteSettings(isRunning bool) (*RPCResponse, error) {
 	}
 
 	if staticRanges, ok := payloadKvs["static_ranges"]; ok {
+		ranges := make(map[string]int)
 		for _, str := range strings.Split(staticRanges, ";") {
 			if len(str) == 4 {
-				c.RemoteSettings.StaticRanges[str] = 1
+				ranges[str] = 1
 			}
 		}
+		c.RemoteSettings.StaticRanges = ranges
 	}
 
 	return resp, nil
 }
 
-// GetRawPKCS12 raw pkck12 file from hath server, including 2 certs and 1 priv key,
-//	2 certs for workload cert and intermediate cert. We need adition setps to handle.
-func (c *Client) GetRawPKCS12() ([]byte, error) {
+// GetRawPKCS12 raw pkck12 file from hath server, including leaf cert, its private key
+//	and intermediate certs. We need adition setps to handle.
+func (c *Client) GetRawPKCS12(ctx context.Context) ([]byte, error) {
 	certURL := c.GetRPCURL(ActionGetCertificate, "")
-	resp, err := c.http.R().Get(certURL.String())
+	resp, err := c.http.R().SetContext(ctx).Get(certURL.String())
 	if err != nil {
 		return nil, err
 	}
@@ -405,66 +649,76 @@ func (c *Client) GetRawPKCS12() ([]byte, error) {
 // GetTLSCertificate the server returns pkcs12 package,
 //	to server contents from HTTPS we need tls.Certificate
 //	to provide digital encrypt and verification.
-func (c *Client) GetTLSCertificate() (*tls.Certificate, error) {
-	pk, err := c.GetRawPKCS12()
+func (c *Client) GetTLSCertificate(ctx context.Context) (*tls.Certificate, error) {
+	pk, err := c.GetRawPKCS12(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// We should using pkcs12 topem method to remove unsupported tags
-	// 	clientkey is used to decode.
-	// ref: https://github.com/golang/go/issues/23499#issuecomment-367849407
-	// It's a workaround for golang pkcs12 package is only for a single file
-	// 	contains only one key and one certificate.
-	pemBlocks, err := pkcs12.ToPEM(pk, c.ClientKey)
+	// cert is issued by server clock
+	tlsCert, err := parsePKCS12Chain(pk, c.ClientKey, c.serverTime())
 	if err != nil {
-		return nil, errors.Wrap(err, "pkcs12 decode")
+		return nil, errors.Wrap(err, "tls cert")
 	}
 
-	var leafCert, intermediateCert *x509.Certificate
-	var privkey []byte
+	return tlsCert, nil
+}
 
-	for _, block := range pemBlocks {
-		p := pem.EncodeToMemory(block)
+// GetStaticRangeFetchURL ...
+func (c *Client) GetStaticRangeFetchURL(ctx context.Context, fileIndex, xres, fileID string) ([]string, error) {
+	resp, err := c.RPCRequestContext(ctx, ActionStaticRangeFetch, fmt.Sprintf("%s;%s;%s", fileIndex, xres, fileID))
+	if err != nil {
+		return nil, err
+	}
 
-		if block.Type == "CERTIFICATE" {
-			cert, err := helpers.ParseCertificatePEM(p)
-			if err != nil {
-				return nil, errors.Wrap(err, "parse cert")
-			}
-			// TODO support multi intermediate certs
-			if cert.IsCA {
-				intermediateCert = cert
-			} else {
-				leafCert = cert
-			}
-		} else if block.Type == "PRIVATE KEY" {
-			key, err := helpers.ParsePrivateKeyPEMWithPassword(p, []byte(c.ClientKey))
-			if err != nil {
-				return nil, errors.Wrap(err, "parse key")
-			}
-			priv, err := x509.MarshalPKCS8PrivateKey(key)
-			if err != nil {
-				return nil, errors.Wrap(err, "marshal key")
-			}
-			privkey = pem.EncodeToMemory(&pem.Block{
-				Type:  "PRIVATE KEY",
-				Bytes: priv,
-			})
+	vurls := resp.Payload.URLs()
+	urls := make([]string, 0, len(vurls))
+	for _, u := range vurls {
+		urls = append(urls, u.String())
+	}
+
+	return urls, err
+}
+
+// GetBlacklist file ids blacklisted within delta
+func (c *Client) GetBlacklist(ctx context.Context, delta time.Duration) ([]string, error) {
+	resp, err := c.RPCRequestContext(ctx, ActionGetBlacklist, strconv.FormatInt(int64(delta.Seconds()), 10))
+	if err != nil {
+		return nil, err
+	}
+
+	fileIDs := make([]string, 0, len(resp.Payload))
+	for _, fileID := range resp.Payload {
+		if util.ValidHVFileID(fileID) {
+			fileIDs = append(fileIDs, fileID)
 		}
 	}
+	return fileIDs, nil
+}
 
-	tlsCert, err := tls.X509KeyPair(helpers.EncodeCertificatesPEM([]*x509.Certificate{leafCert, intermediateCert}), privkey)
+// GetDownloaderQueue raw metadata of next queued gallery, the last finished gallery
+//	is passed to mark it as done, lastGID is 0 if there is none.
+func (c *Client) GetDownloaderQueue(ctx context.Context, lastGID int, lastXres string) ([]byte, error) {
+	add := ""
+	if lastGID > 0 {
+		add = fmt.Sprintf("%v;%s", lastGID, lastXres)
+	}
+	resp, err := c.http.R().SetContext(ctx).Get(c.GetRPCURL(ActionDownloaderQueue, add).String())
 	if err != nil {
-		return nil, errors.Wrap(err, "tls cert")
+		return nil, err
 	}
 
-	return &tlsCert, nil
+	return resp.Body(), nil
 }
 
-// GetStaticRangeFetchURL ...
-func (c *Client) GetStaticRangeFetchURL(fileIndex, xres, fileID string) ([]string, error) {
-	resp, err := c.RPCRequest(ActionStaticRangeFetch, fmt.Sprintf("%s;%s;%s", fileIndex, xres, fileID))
+// GetDownloaderFetchURL urls of a gallery file, force to fetch from image server
+//	instead of other h@h clients, it's used for retries.
+func (c *Client) GetDownloaderFetchURL(ctx context.Context, gid, page, fileIndex int, xres string, force bool) ([]string, error) {
+	forceImageServer := 0
+	if force {
+		forceImageServer = 1
+	}
+	resp, err := c.RPCRequestContext(ctx, ActionDownloaderFetch, fmt.Sprintf("%v;%v;%v;%s;%v", gid, page, fileIndex, xres, forceImageServer))
 	if err != nil {
 		return nil, err
 	}
@@ -474,13 +728,34 @@ func (c *Client) GetStaticRangeFetchURL(fileIndex, xres, fileID string) ([]strin
 	for _, u := range vurls {
 		urls = append(urls, u.String())
 	}
+	return urls, nil
+}
 
-	return urls, err
+// ReportDownloaderFailures each failure is formed as $host-$fileindex-$xres
+func (c *Client) ReportDownloaderFailures(ctx context.Context, failures []string) error {
+	_, err := c.RPCRequestContext(ctx, ActionDownloaderFailreport, strings.Join(failures, ";"))
+	return err
+}
+
+// NotifyOverload ask server to route traffic away from this client, notifications are
+//	rate limited like the Java client, returns false if it's skipped.
+func (c *Client) NotifyOverload(ctx context.Context) (bool, error) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&c.lastOverload)
+	if now-last < int64(OverloadNotifyInterval) || !atomic.CompareAndSwapInt64(&c.lastOverload, last, now) {
+		return false, nil
+	}
+
+	if _, err := c.RPCRequestContext(ctx, ActionOverload, ""); err != nil {
+		return true, err
+	}
+	return true, nil
 }
 
-// NotifyStarted notify h@h server we are ready to receive requests
-func (c *Client) NotifyStarted() error {
-	_, err := c.RPCRequest(ActionClientStart, "")
+// NotifyStarted notify h@h server we are ready to receive requests,
+//	cache usage is reported along with it.
+func (c *Client) NotifyStarted(ctx context.Context, fileCount, cacheSize int64) error {
+	_, err := c.RPCRequestContext(ctx, ActionClientStart, fmt.Sprintf("filecount=%v;cachesize=%v", fileCount, cacheSize))
 	if err != nil {
 		return err
 	}
@@ -489,8 +764,8 @@ func (c *Client) NotifyStarted() error {
 }
 
 // NotifyShutdown notify h@h server we are shutdown
-func (c *Client) NotifyShutdown() error {
-	_, err := c.RPCRequest(ActionClientStop, "")
+func (c *Client) NotifyShutdown(ctx context.Context) error {
+	_, err := c.RPCRequestContext(ctx, ActionClientStop, "")
 	if err != nil {
 		return err
 	}
@@ -1,89 +1,271 @@
 package hath
 
 import (
-	"os"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
 	"testing"
+	"time"
 
-	"github.com/joho/godotenv"
-	"github.com/spf13/afero"
+	"github.com/mayocream/hath-go/pkg/hath/hathtest"
+	"github.com/mayocream/hath-go/pkg/hath/util"
 )
 
-func testClient() *Client {
-	if err := godotenv.Load("../../.env"); err != nil {
-		panic(err)
-	}
-	c, err := NewClient(Settings{
-		ClientID:  os.Getenv("HATH_CLIENT_ID"),
-		ClientKey: os.Getenv("HATH_CLIENT_KEY"),
-	})
+const (
+	testClientID  = "12345"
+	testClientKey = "abcdefghijklmnopqrst"
+)
+
+// testClient client of fake rpc server
+func testClient(t *testing.T) (*Client, *hathtest.Server) {
+	fake := hathtest.NewServer(testClientID, testClientKey)
+	t.Cleanup(fake.Close)
+
+	c, err := NewClient(context.Background(), Settings{
+		ClientID:  testClientID,
+		ClientKey: testClientKey,
+	}, WithRPCBaseURL(fake.RPCURL()))
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	return c
+	return c, fake
 }
 
 func TestClient_GetRPCURL(t *testing.T) {
-	c, err := NewClient(Settings{
-		ClientID:  "1",
-		ClientKey: "12345678901234567890",
-	})
+	c, fake := testClient(t)
+
+	uri := c.GetRPCURL(ActionStaticRangeFetch, "1;org;abc")
+	if uri.Host != fake.RPCURL().Host || uri.Path != hathtest.RPCPath {
+		t.Fatalf("unexpected endpoint: %s", uri)
+	}
+	q := uri.Query()
+	key := util.SHA1(fmt.Sprintf("hentai@home-%s-%s-%s-%s-%s",
+		ActionStaticRangeFetch, "1;org;abc", testClientID, q.Get("acttime"), testClientKey))
+	if q.Get("add") != "1;org;abc" || q.Get("cid") != testClientID || q.Get("actkey") != key {
+		t.Fatalf("unexpected query: %s", uri.RawQuery)
+	}
+}
+
+func TestClient_RPCRawRequest(t *testing.T) {
+	c, fake := testClient(t)
+
+	resp, err := c.RPCRawRequest(c.GetRPCURL(ActionServerStat, ""))
 	if err != nil {
 		t.Fatal(err)
 	}
+	if resp.Status != ResponseStatusOK || resp.Payload.KeyValues()["server_time"] == "" {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
 
-	uri := c.GetRPCURL(ActionServerStat, "")
-	t.Log("uri: ", uri)
+	fake.Handle(string(ActionStillAlive), func(add string) string { return "FAIL_CONNECT_TEST" })
+	if _, err := c.RPCRequest(ActionStillAlive, ""); err != ErrConnectTestFailed {
+		t.Fatalf("expected connect test error, got: %v", err)
+	}
 }
 
-func TestClient_RPCRawRequest(t *testing.T) {
-	c, err := NewClient(Settings{
-		ClientID:  "1",
-		ClientKey: "12345678901234567890",
-	})
+func TestClient_SyncTimeDelta(t *testing.T) {
+	c, fake := testClient(t)
+
+	fake.SetTimeDelta(time.Hour)
+	if err := c.SyncTimeDelta(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if delta := c.correctedTime() - util.SystemTime(); delta < 3599 || delta > 3601 {
+		t.Fatalf("unexpected time delta: %v", delta)
+	}
+	// signed with corrected time
+	if _, err := c.RPCRequest(ActionStillAlive, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_FetchRemoteSettings(t *testing.T) {
+	c, fake := testClient(t)
+
+	fake.SetSetting("static_ranges", "0a1b;ffff")
+	fake.SetSetting("port", "8443")
+	if _, err := c.FetchRemoteSettings(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if c.RemoteSettings.ServerPort != 8443 {
+		t.Fatalf("unexpected port: %v", c.RemoteSettings.ServerPort)
+	}
+	if !c.RemoteSettings.InStaticRange("0a1b2c") || c.RemoteSettings.InStaticRange("1234ab") {
+		t.Fatalf("unexpected static ranges: %v", c.RemoteSettings.StaticRanges)
+	}
+}
+
+func TestClient_GetTLSCertificate(t *testing.T) {
+	c, fake := testClient(t)
+
+	cert, err := c.GetTLSCertificate(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(cert.Certificate) != 2 {
+		t.Fatalf("expected leaf and intermediate cert, got: %v", len(cert.Certificate))
+	}
 
-	u := c.GetRPCURL(ActionServerStat, "")
-	resp, err := c.RPCRawRequest(u)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("%#v", resp)
+	inter, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, inters := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(fake.RootCA())
+	inters.AddCert(inter)
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       testClientID + ".hath.network",
+		Roots:         roots,
+		Intermediates: inters,
+	}); err != nil {
+		t.Fatal(err)
+	}
 }
 
-func TestClient_FetchRemoteSettings(t *testing.T) {
-	c := testClient()
+func TestServer_HandleHV(t *testing.T) {
+	c, fake := testClient(t)
+
+	data, _ := testHVData(t)
+	fileID := fake.AddFile(data, "jpg")
+	fake.SetSetting("static_ranges", fileID[:4])
+	if _, err := c.FetchRemoteSettings(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
 
-	resp, err := c.FetchRemoteSettings(false)
+	s := testServer()
+	s.HC, s.DL, s.Stor = c, NewDownloader(), testStorage(t)
+
+	add := "fileindex=1;xres=org;keystamp=" + testKeystamp(fileID)
+
+	// miss, proxied from upstream then cached
+	_, r, err := s.HandleHV(context.Background(), fileID, add, "1.jpg")
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("%#v", resp)
+	out, _ := io.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(out, data) {
+		t.Fatal("unexpected proxied data")
+	}
 
-	resp, err = c.FetchRemoteSettings(true)
+	// commit is async
+	time.Sleep(100 * time.Millisecond)
+	_, r, err = s.HandleHV(context.Background(), fileID, add, "1.jpg")
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("%#v", resp)
+	r.Close()
+	if n := fake.Calls(string(ActionStaticRangeFetch)); n != 1 {
+		t.Fatalf("second request should hit cache, srfetch calls: %v", n)
+	}
 }
 
-func TestClient_GetRawPKCS12(t *testing.T) {
-	c := testClient()
+func TestClient_RPCRequestFailover(t *testing.T) {
+	fake := hathtest.NewServer(testClientID, testClientKey)
+	defer fake.Close()
+	fake.SetSetting("rpc_server_ip", "192.0.2.1;192.0.2.2")
 
-	resp, err := c.GetRawPKCS12()
+	c, err := NewClient(context.Background(), Settings{
+		ClientID:  testClientID,
+		ClientKey: testClientKey,
+	}, WithTransport(fake.Transport()))
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(c.RPCServers.Hosts) != 2 {
+		t.Fatalf("unexpected rpc servers: %v", c.RPCServers.Hosts)
+	}
 
-	afero.WriteFile(afero.NewBasePathFs(afero.NewOsFs(), "."), "hathcert.p12", resp, 7777)
+	fake.SetHostDown("192.0.2.1", true)
+	for i := 0; i < 4; i++ {
+		if _, err := c.RPCRequest(ActionStillAlive, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// failing host is demoted after first failure
+	if n := fake.HostCalls("192.0.2.1"); n > 1 {
+		t.Fatalf("demoted host should be skipped, calls: %v", n)
+	}
+	if !c.RPCServers.isDemoted("192.0.2.1") || c.RPCServers.healthy() != 1 {
+		t.Fatal("failing host should be demoted")
+	}
 }
 
-func TestClient_GetTLSCertificate(t *testing.T) {
-	c := testClient()
+func TestNewClient_Cancel(t *testing.T) {
+	fake := hathtest.NewServer(testClientID, testClientKey)
+	defer fake.Close()
+	fake.SetHostDown(fake.RPCURL().Host, true)
 
-	_, err := c.GetTLSCertificate()
-	if err != nil {
-		panic(err)
+	// startup rpc calls retry with backoff, shutdown must not wait for them
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := NewClient(ctx, Settings{
+		ClientID:  testClientID,
+		ClientKey: testClientKey,
+	}, WithRPCBaseURL(fake.RPCURL())); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("startup should stop once cancelled, took: %s", d)
+	}
+}
+
+func TestClient_RPCRequestKeyExpired(t *testing.T) {
+	c, fake := testClient(t)
+
+	// server clock changed, client resyncs once
+	fake.SetTimeDelta(time.Hour)
+	if _, err := c.RPCRequest(ActionStillAlive, ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.Calls(string(ActionStillAlive)); n != 2 {
+		t.Fatalf("expected 1 retry, calls: %v", n)
+	}
+
+	// retry is bounded
+	fake.Handle(string(ActionStillAlive), func(add string) string { return "KEY_EXPIRED" })
+	if _, err := c.RPCRequest(ActionStillAlive, ""); err != ErrKeyExpired {
+		t.Fatalf("expected key expired error, got: %v", err)
+	}
+	if n := fake.Calls(string(ActionStillAlive)); n != 4 {
+		t.Fatalf("expected 1 retry, calls: %v", n)
+	}
+}
+
+func TestClient_RPCRequestContext(t *testing.T) {
+	c, fake := testClient(t)
+
+	fake.Handle(string(ActionStillAlive), func(add string) string { return "TEMPORARILY_UNAVAILABLE" })
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.RPCRequestContext(ctx, ActionStillAlive, ""); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+	if n := fake.Calls(string(ActionStillAlive)); n != 1 {
+		t.Fatalf("backoff should be interrupted, calls: %v", n)
+	}
+}
+
+func TestClient_NotifyOverload(t *testing.T) {
+	c, fake := testClient(t)
+
+	sent, err := c.NotifyOverload(context.Background())
+	if err != nil || !sent {
+		t.Fatalf("first notification should be sent: %v, %v", sent, err)
+	}
+	// rate limited
+	sent, err = c.NotifyOverload(context.Background())
+	if err != nil || sent {
+		t.Fatalf("notification should be skipped: %v, %v", sent, err)
+	}
+	if n := fake.Calls(string(ActionOverload)); n != 1 {
+		t.Fatalf("unexpected overload calls: %v", n)
 	}
 }
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package hath
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// diskFree available bytes on the disk holding path
+func diskFree(path string) (int64, error) {
+	// db dir might not exist yet
+	if _, err := os.Stat(path); err != nil {
+		path = filepath.Dir(path)
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
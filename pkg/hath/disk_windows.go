@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package hath
+
+import (
+	"github.com/pkg/errors"
+)
+
+// diskFree not supported on windows yet
+func diskFree(path string) (int64, error) {
+	return 0, errors.New("disk free space check not supported")
+}
@@ -3,6 +3,7 @@ package hath
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"io"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 var copyBufPool = sync.Pool{
@@ -38,10 +40,19 @@ func NewDownloader() *Downloader {
 	}
 }
 
+// get request is cancelled with ctx, including reading body
+func (d *Downloader) get(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	return d.c.Do(req)
+}
+
 // DiscardDownload ...
-func (d *Downloader) DiscardDownload(uri string) (time.Duration, error) {
+func (d *Downloader) DiscardDownload(ctx context.Context, uri string) (time.Duration, error) {
 	startTime := time.Now()
-	resp, err := d.c.Get(uri)
+	resp, err := d.get(ctx, uri)
 	if err != nil {
 		return -1, errors.New("network error")
 	}
@@ -54,38 +65,84 @@ func (d *Downloader) DiscardDownload(uri string) (time.Duration, error) {
 	return elapseTime, nil
 }
 
-// MultipleSourcesDownload download from multi sources
-func (d *Downloader) MultipleSourcesDownload(sources []string, hv *HVFile) ([]byte, error) {
+// MultipleSourcesDownload download from multi sources, content with wrong size
+//	or SHA-1 hash is rejected and next source is tried.
+func (d *Downloader) MultipleSourcesDownload(ctx context.Context, sources []string, hv *HVFile) ([]byte, error) {
 	vbuf := copyBufPool.Get()
 	buf := vbuf.([]byte)
 	defer copyBufPool.Put(vbuf)
 
 	// TODO load balancer
 	for _, s := range sources {
-		resp, err := d.c.Get(s)
+		data, err := d.fetchVerified(ctx, s, hv, buf)
 		if err != nil {
+			zap.S().With("url", s, "fileID", hv.FileID()).Warnf("Downloader, try next source: %s", err)
 			continue
 		}
-		if resp.ContentLength < 0 || resp.ContentLength != int64(hv.Size) {
+
+		return data, nil
+	}
+
+	return nil, errors.New("not avaliable sources")
+}
+
+// MultipleSourcesStream body of the first available source, content can't be
+//	verified before it's consumed, caller should check it while reading.
+func (d *Downloader) MultipleSourcesStream(ctx context.Context, sources []string, hv *HVFile) (io.ReadCloser, error) {
+	for _, s := range sources {
+		body, err := d.openSource(ctx, s, hv)
+		if err != nil {
+			zap.S().With("url", s, "fileID", hv.FileID()).Warnf("Downloader, try next source: %s", err)
 			continue
 		}
-	
-		data := &bytes.Buffer{}
-	
-		if _, err := io.CopyBuffer(data, resp.Body, buf); err != nil {
-			return nil, err
-		}
-		
-		// TODO return io.reader
-		return data.Bytes(), nil
+		return body, nil
 	}
 
 	return nil, errors.New("not avaliable sources")
 }
 
+// openSource response body if its content length matches file size
+func (d *Downloader) openSource(ctx context.Context, uri string, hv *HVFile) (io.ReadCloser, error) {
+	resp, err := d.get(ctx, uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "network error")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("http code: %v", resp.StatusCode)
+	}
+	if resp.ContentLength < 0 || resp.ContentLength != int64(hv.Size) {
+		resp.Body.Close()
+		return nil, errors.Errorf("content length mismatch: %v", resp.ContentLength)
+	}
+
+	return resp.Body, nil
+}
+
+// fetchVerified download file and check its size and SHA-1 hash
+func (d *Downloader) fetchVerified(ctx context.Context, uri string, hv *HVFile, buf []byte) ([]byte, error) {
+	body, err := d.openSource(ctx, uri, hv)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data := bytes.NewBuffer(make([]byte, 0, hv.Size))
+	if _, err := io.CopyBuffer(data, body, buf); err != nil {
+		return nil, errors.Wrap(err, "copy")
+	}
+
+	if err := hv.Verify(data.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return data.Bytes(), nil
+}
+
 // DummyDownload ...
-func (d *Downloader) DummyDownload(uri string) ([]byte, error) {
-	resp, err := d.c.Get(uri)
+func (d *Downloader) DummyDownload(ctx context.Context, uri string) ([]byte, error) {
+	resp, err := d.get(ctx, uri)
 	if err != nil {
 		return nil, errors.New("network error")
 	}
@@ -106,8 +163,8 @@ func (d *Downloader) DummyDownload(uri string) ([]byte, error) {
 
 // ProxyDownload ...
 // TODO
-func (d *Downloader) ProxyDownload(uri string) (io.Reader, error) {
-	resp, err := d.c.Get(uri)
+func (d *Downloader) ProxyDownload(ctx context.Context, uri string) (io.Reader, error) {
+	resp, err := d.get(ctx, uri)
 	if err != nil {
 		return nil, errors.New("network error")
 	}
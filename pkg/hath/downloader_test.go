@@ -1,70 +1,50 @@
 package hath
 
 import (
-	"fmt"
+	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"testing"
+
+	"github.com/mayocream/hath-go/pkg/hath/hathtest"
 )
 
+// testSources urls of files served by fake server, the first one is missing.
+func testSources(t *testing.T) (*HVFile, []string, []byte) {
+	fake := hathtest.NewServer(testClientID, testClientKey)
+	t.Cleanup(fake.Close)
+
+	data, hv := testHVData(t)
+	fake.AddFile(data, "jpg")
+	return hv, []string{fake.URL + "/h/missing", fake.URL + "/h/" + hv.FileID()}, data
+}
+
 func TestDownloader_DiscardDownload(t *testing.T) {
 	d := &Downloader{
 		c: http.DefaultClient,
 	}
+	_, sources, _ := testSources(t)
 
-	cases := []struct {
-		uri string
-	}{
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter010/00-a.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/00-f.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/41.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/42.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/43.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/44.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/45.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/46.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/46.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/47.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/48.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/49.jpg"},
-	}
-	for _, cs := range cases {
-		duration, err := d.DiscardDownload(cs.uri)
-		if err != nil {
-			t.Fatal(err)
-		}
-		fmt.Println("duration: ", duration)
+	duration, err := d.DiscardDownload(context.Background(), sources[1])
+	if err != nil {
+		t.Fatal(err)
 	}
+	t.Log("duration: ", duration)
 }
 
 func TestDownloader_DummyDownload(t *testing.T) {
 	d := &Downloader{
 		c: http.DefaultClient,
 	}
+	_, sources, data := testSources(t)
 
-	cases := []struct {
-		uri string
-	}{
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter010/00-a.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/00-f.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/41.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/42.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/43.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/44.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/45.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/46.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/46.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/47.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/48.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/49.jpg"},
-	}
-
-	for _, cs := range cases {
-		data, err := d.DummyDownload(cs.uri)
-		if err != nil {
-			t.Fatal(err)
-		}
-		t.Logf("content length: %v", len(data))
+	out, err := d.DummyDownload(context.Background(), sources[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("unexpected content length: %v", len(out))
 	}
 }
 
@@ -72,33 +52,70 @@ func TestDownloader_ProxyDownload(t *testing.T) {
 	d := &Downloader{
 		c: http.DefaultClient,
 	}
+	_, sources, data := testSources(t)
+
+	reader, err := d.ProxyDownload(context.Background(), sources[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("unexpected content length: %v", len(out))
+	}
+}
+
+func TestDownloader_MultipleSourcesDownload(t *testing.T) {
+	d := &Downloader{
+		c: http.DefaultClient,
+	}
+	hv, sources, data := testSources(t)
+
+	out, err := d.MultipleSourcesDownload(context.Background(), sources, hv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("unexpected content length: %v", len(out))
+	}
+}
+
+func TestDownloader_MultipleSourcesDownloadVerify(t *testing.T) {
+	d := &Downloader{
+		c: http.DefaultClient,
+	}
+	fake := hathtest.NewServer(testClientID, testClientKey)
+	t.Cleanup(fake.Close)
+
+	data, hv := testHVData(t)
+	fake.AddFile(data, "jpg")
+	// same size, different content
+	forged := fake.AddFile(bytes.Repeat([]byte("htah"), len(data)/4), "jpg")
+	sources := []string{fake.URL + "/h/" + forged, fake.URL + "/h/" + hv.FileID()}
+
+	out, err := d.MultipleSourcesDownload(context.Background(), sources, hv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("content of forged source should be rejected")
+	}
+	if _, err := d.MultipleSourcesDownload(context.Background(), sources[:1], hv); err == nil {
+		t.Fatal("download should fail without valid source")
+	}
+}
+
+func TestDownloader_MultipleSourcesStreamCancel(t *testing.T) {
+	d := &Downloader{
+		c: http.DefaultClient,
+	}
+	hv, sources, _ := testSources(t)
 
-	cases := []struct {
-		uri string
-	}{
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter010/00-a.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/00-f.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/41.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/42.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/43.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/44.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/45.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/46.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/46.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/47.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/48.jpg"},
-		{uri: "https://raw.githubusercontent.com/lyy289065406/re0-web/master/gitbook/res/img/article/chapter030/49.jpg"},
-	}
-
-	for _, cs := range cases {
-		reader, err := d.ProxyDownload(cs.uri)
-		if err != nil {
-			t.Fatal(err)
-		}
-		data, err := io.ReadAll(reader)
-		if err != nil {
-			t.Fatal(err)
-		}
-		t.Logf("content length: %v", len(data))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.MultipleSourcesStream(ctx, sources, hv); err == nil {
+		t.Fatal("cancelled download should fail")
 	}
 }
@@ -0,0 +1,430 @@
+package hath
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+)
+
+const (
+	// galleryFileTimeout original images can be large
+	galleryFileTimeout = 5 * time.Minute
+	// maxFailuresPerReport failures are reported in batches
+	maxFailuresPerReport = 50
+)
+
+// ErrNoPendingDownloads downloader queue is empty
+var ErrNoPendingDownloads = errors.New("no pending downloads")
+
+// DownloaderConf ...
+type DownloaderConf struct {
+	// DownloadDir galleries are saved at $download_dir/$title [$gid]
+	DownloadDir string `mapstructure:"download_dir"`
+	// DownloadRetries attempts of each file, retries are fetched from image server
+	DownloadRetries int `mapstructure:"download_retries"`
+}
+
+// Gallery metadata of queued gallery
+type Gallery struct {
+	GID         int
+	FileCount   int
+	MinXres     string
+	Title       string
+	Information string
+	Files       []GalleryFile
+}
+
+// GalleryFile ...
+type GalleryFile struct {
+	Page      int
+	FileIndex int
+	Xres      string
+	Hash      string
+	Type      string
+	Name      string
+}
+
+// DownloadProgress ...
+type DownloadProgress struct {
+	Running    bool   `json:"running"`
+	GID        int    `json:"gid"`
+	Title      string `json:"title"`
+	FileCount  int    `json:"file_count"`
+	Downloaded int    `json:"downloaded"`
+	Failed     int    `json:"failed"`
+	// Galleries finished since startup
+	Galleries int `json:"galleries"`
+}
+
+// GalleryDownloader H@H gallery downloader, it's started by start_downloader server command,
+//	then fetches queued galleries until the queue is empty.
+type GalleryDownloader struct {
+	conf   DownloaderConf
+	hc     *Client
+	dl     *Downloader
+	logger *zap.SugaredLogger
+
+	trigger chan struct{}
+
+	mu       sync.RWMutex
+	progress DownloadProgress
+}
+
+// NewGalleryDownloader ...
+func NewGalleryDownloader(conf DownloaderConf, hc *Client) *GalleryDownloader {
+	if conf.DownloadRetries <= 0 {
+		conf.DownloadRetries = 3
+	}
+	return &GalleryDownloader{
+		conf: conf,
+		hc:   hc,
+		dl: &Downloader{
+			c: &http.Client{
+				Timeout: galleryFileTimeout,
+			},
+		},
+		logger:  zap.S().Named("downloader"),
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Trigger wake up downloader, it's no-op if downloader is running
+func (g *GalleryDownloader) Trigger() {
+	select {
+	case g.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Progress ...
+func (g *GalleryDownloader) Progress() DownloadProgress {
+	defer g.mu.RUnlock()
+	g.mu.RLock()
+
+	return g.progress
+}
+
+func (g *GalleryDownloader) updateProgress(fn func(p *DownloadProgress)) {
+	defer g.mu.Unlock()
+	g.mu.Lock()
+
+	fn(&g.progress)
+}
+
+// Run wait for triggers until ctx is done
+func (g *GalleryDownloader) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.trigger:
+		}
+
+		g.updateProgress(func(p *DownloadProgress) { p.Running = true })
+		if err := g.drainQueue(ctx); err != nil {
+			g.logger.Errorf("Downloader, %s", err)
+		}
+		g.updateProgress(func(p *DownloadProgress) { p.Running = false })
+	}
+}
+
+// drainQueue download galleries until queue is empty
+func (g *GalleryDownloader) drainQueue(ctx context.Context) error {
+	var lastGID int
+	var lastXres string
+	for ctx.Err() == nil {
+		gallery, err := g.fetchGallery(ctx, lastGID, lastXres)
+		if err != nil {
+			if errors.Is(err, ErrNoPendingDownloads) {
+				g.logger.Info("Downloader, no pending downloads.")
+				return nil
+			}
+			return err
+		}
+
+		g.logger.Infof("Downloader, start gallery: %v, %s, %v files.", gallery.GID, gallery.Title, gallery.FileCount)
+		if err := g.downloadGallery(ctx, gallery); err != nil {
+			return errors.Wrapf(err, "gallery %v", gallery.GID)
+		}
+		lastGID, lastXres = gallery.GID, gallery.MinXres
+	}
+	return ctx.Err()
+}
+
+func (g *GalleryDownloader) fetchGallery(ctx context.Context, lastGID int, lastXres string) (*Gallery, error) {
+	meta, err := g.hc.GetDownloaderQueue(ctx, lastGID, lastXres)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch queue")
+	}
+	return ParseGalleryMeta(meta)
+}
+
+// ParseGalleryMeta metadata form:
+//	GID $gid
+//	FILECOUNT $count
+//	MINXRES $xres
+//	TITLE $title
+//	INFORMATION
+//	$lines...
+//	FILELIST
+//	$page $fileindex $xres $hash $type $filename
+func ParseGalleryMeta(meta []byte) (*Gallery, error) {
+	// tolerate rpc status line
+	meta = bytes.TrimPrefix(meta, []byte("OK\n"))
+	text := strings.TrimSpace(string(meta))
+	if text == "NO_PENDING_DOWNLOADS" {
+		return nil, ErrNoPendingDownloads
+	}
+	if text == "" || text == "INVALID_REQUEST" {
+		return nil, errors.Errorf("invalid gallery meta: %q", text)
+	}
+
+	gallery := &Gallery{}
+	info := &strings.Builder{}
+	const (
+		stateHeader = iota
+		stateInformation
+		stateFileList
+	)
+	state := stateHeader
+
+	scanner := bufio.NewScanner(bytes.NewReader(meta))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "INFORMATION":
+			state = stateInformation
+			continue
+		case line == "FILELIST":
+			state = stateFileList
+			continue
+		}
+
+		switch state {
+		case stateInformation:
+			info.WriteString(line)
+			info.WriteString("\n")
+		case stateFileList:
+			parts := strings.SplitN(line, " ", 6)
+			if len(parts) != 6 {
+				continue
+			}
+			gallery.Files = append(gallery.Files, GalleryFile{
+				Page:      cast.ToInt(parts[0]),
+				FileIndex: cast.ToInt(parts[1]),
+				Xres:      parts[2],
+				Hash:      parts[3],
+				Type:      parts[4],
+				Name:      parts[5],
+			})
+		default:
+			kv := strings.SplitN(line, " ", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "GID":
+				gallery.GID = cast.ToInt(kv[1])
+			case "FILECOUNT":
+				gallery.FileCount = cast.ToInt(kv[1])
+			case "MINXRES":
+				gallery.MinXres = kv[1]
+			case "TITLE":
+				gallery.Title = kv[1]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	gallery.Information = info.String()
+
+	if gallery.GID <= 0 || len(gallery.Files) == 0 {
+		return nil, errors.New("invalid gallery meta: missing gid or files")
+	}
+	if gallery.FileCount == 0 {
+		gallery.FileCount = len(gallery.Files)
+	}
+	return gallery, nil
+}
+
+var unsafeFileNameRegex = regexp.MustCompile(`[\\/:*?"<>|\x00-\x1f]`)
+
+// Dir $title [$gid], xres is appended unless original images
+func (gallery *Gallery) Dir() string {
+	title := strings.TrimSpace(unsafeFileNameRegex.ReplaceAllString(gallery.Title, ""))
+	if r := []rune(title); len(r) > 100 {
+		title = string(r[:100])
+	}
+	if gallery.MinXres == "" || gallery.MinXres == "org" {
+		return fmt.Sprintf("%s [%v]", title, gallery.GID)
+	}
+	return fmt.Sprintf("%s [%v-%s]", title, gallery.GID, gallery.MinXres)
+}
+
+// safeJoin join name supplied by server under dir, names escaping dir are rejected.
+func safeJoin(dir, name string) (string, error) {
+	base := filepath.Base(unsafeFileNameRegex.ReplaceAllString(name, "_"))
+	if strings.TrimSpace(base) == "" || base == "." || base == ".." {
+		return "", errors.Errorf("unsafe file name: %q", name)
+	}
+	path := filepath.Join(dir, base)
+	if rel, err := filepath.Rel(dir, path); err != nil || rel != base {
+		return "", errors.Errorf("unsafe file name: %q", name)
+	}
+	return path, nil
+}
+
+func (g *GalleryDownloader) downloadGallery(ctx context.Context, gallery *Gallery) error {
+	dir, err := safeJoin(g.conf.DownloadDir, gallery.Dir())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if gallery.Information != "" {
+		if err := os.WriteFile(filepath.Join(dir, "galleryinfo.txt"), []byte(gallery.Information), 0644); err != nil {
+			return err
+		}
+	}
+
+	g.updateProgress(func(p *DownloadProgress) {
+		p.GID, p.Title, p.FileCount = gallery.GID, gallery.Title, gallery.FileCount
+		p.Downloaded, p.Failed = 0, 0
+	})
+
+	var failures []string
+	for _, file := range gallery.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path, err := safeJoin(dir, file.Name)
+		if err != nil {
+			g.logger.With("gid", gallery.GID, "page", file.Page).Errorf("Downloader, skip file: %s", err)
+			g.updateProgress(func(p *DownloadProgress) { p.Failed++ })
+			continue
+		}
+		fileFailures, err := g.downloadFile(ctx, gallery.GID, file, path)
+		failures = append(failures, fileFailures...)
+		if err != nil {
+			g.logger.With("gid", gallery.GID, "page", file.Page).Errorf("Downloader, give up file: %s", err)
+			g.updateProgress(func(p *DownloadProgress) { p.Failed++ })
+			continue
+		}
+		g.updateProgress(func(p *DownloadProgress) { p.Downloaded++ })
+	}
+
+	g.reportFailures(ctx, failures)
+	g.updateProgress(func(p *DownloadProgress) { p.Galleries++ })
+	g.logger.Infof("Downloader, finished gallery: %v, %v", gallery.GID, g.Progress())
+	return nil
+}
+
+// downloadFile returns failures formed as $host-$fileindex-$xres
+func (g *GalleryDownloader) downloadFile(ctx context.Context, gid int, file GalleryFile, path string) ([]string, error) {
+	// already downloaded by previous run
+	if err := verifyFileHash(path, file.Hash); err == nil {
+		return nil, nil
+	}
+
+	var failures []string
+	lastErr := errors.New("no sources")
+	for attempt := 0; attempt < g.conf.DownloadRetries; attempt++ {
+		urls, err := g.hc.GetDownloaderFetchURL(ctx, gid, file.Page, file.FileIndex, file.Xres, attempt > 0)
+		if err != nil {
+			lastErr = errors.Wrap(err, "fetch url")
+			continue
+		}
+		for _, u := range urls {
+			if err := g.dl.DownloadToFile(ctx, u, path, file.Hash); err != nil {
+				lastErr = err
+				if uu, err := url.Parse(u); err == nil {
+					failures = append(failures, fmt.Sprintf("%s-%v-%s", uu.Host, file.FileIndex, file.Xres))
+				}
+				continue
+			}
+			return failures, nil
+		}
+	}
+	return failures, lastErr
+}
+
+func (g *GalleryDownloader) reportFailures(ctx context.Context, failures []string) {
+	for len(failures) > 0 {
+		n := len(failures)
+		if n > maxFailuresPerReport {
+			n = maxFailuresPerReport
+		}
+		if err := g.hc.ReportDownloaderFailures(ctx, failures[:n]); err != nil {
+			g.logger.Errorf("Downloader, report failures: %s", err)
+			return
+		}
+		failures = failures[n:]
+	}
+}
+
+// DownloadToFile download to temp file, it's renamed to path if SHA-1 matches hash
+func (d *Downloader) DownloadToFile(ctx context.Context, uri, path, hash string) error {
+	resp, err := d.get(ctx, uri)
+	if err != nil {
+		return errors.Wrap(err, "network error")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("http code: %v", resp.StatusCode)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+tmpFileSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	h := sha1.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "copy")
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != hash {
+		return errors.Errorf("hash mismatch, expected: %s, got: %s", hash, sum)
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func verifyFileHash(path, hash string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return errors.New("hash mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package hath
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseGalleryMeta(t *testing.T) {
+	meta := "GID 1234\n" +
+		"FILECOUNT 2\n" +
+		"MINXRES 1280\n" +
+		"TITLE Some: Gallery/Title\n" +
+		"INFORMATION\n" +
+		"Tags: test\n" +
+		"FILELIST\n" +
+		"1 100 1280 0123456789abcdef0123456789abcdef01234567 jpg 001 cover.jpg\n" +
+		"2 101 1280 76543210fedcba9876543210fedcba9876543210 png 002.png\n"
+
+	gallery, err := ParseGalleryMeta([]byte(meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gallery.GID != 1234 || gallery.FileCount != 2 || gallery.MinXres != "1280" || len(gallery.Files) != 2 {
+		t.Fatalf("unexpected gallery: %+v", gallery)
+	}
+	if gallery.Files[0].Name != "001 cover.jpg" || gallery.Files[1].FileIndex != 101 {
+		t.Fatalf("unexpected files: %+v", gallery.Files)
+	}
+	if gallery.Information != "Tags: test\n" {
+		t.Fatalf("unexpected information: %q", gallery.Information)
+	}
+	if dir := gallery.Dir(); dir != "Some GalleryTitle [1234-1280]" {
+		t.Fatalf("unexpected dir: %s", dir)
+	}
+
+	if _, err := ParseGalleryMeta([]byte("NO_PENDING_DOWNLOADS\n")); err != ErrNoPendingDownloads {
+		t.Fatalf("expected no pending downloads, got: %v", err)
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	dir := filepath.Join("downloads", "gallery [1]")
+	for _, name := range []string{"..", ".", "", " "} {
+		if path, err := safeJoin(dir, name); err == nil {
+			t.Fatalf("name %q should be rejected, got: %s", name, path)
+		}
+	}
+	if path, err := safeJoin(dir, "../001.jpg"); err != nil || path != filepath.Join(dir, ".._001.jpg") {
+		t.Fatalf("unexpected path: %s, %v", path, err)
+	}
+}
+
+func TestGalleryDownloader_DrainQueue(t *testing.T) {
+	c, fake := testClient(t)
+	good := fake.AddFile([]byte("page one"), "jpg")
+	retried := fake.AddFile([]byte("page two"), "jpg")
+	hash := func(fileID string) string { return strings.Split(fileID, "-")[0] }
+
+	meta := "GID 1\nTITLE Test\nFILELIST\n" +
+		fmt.Sprintf("1 101 org %s jpg 001.jpg\n", hash(good)) +
+		fmt.Sprintf("2 102 org %s jpg ..\n", hash(good)) +
+		fmt.Sprintf("3 103 org %s jpg 003.jpg\n", hash(retried))
+	queued := true
+	fake.Handle(string(ActionDownloaderQueue), func(add string) string {
+		if queued {
+			queued = false
+			return meta
+		}
+		return "NO_PENDING_DOWNLOADS"
+	})
+	// $gid;$page;$fileindex;$xres;$force
+	fake.Handle(string(ActionDownloaderFetch), func(add string) string {
+		parts := strings.Split(add, ";")
+		switch {
+		case parts[1] == "1":
+			return "OK\n" + fake.URL + "/h/" + good
+		case parts[4] == "1":
+			return "OK\n" + fake.URL + "/h/" + retried
+		default:
+			return "OK\n" + fake.URL + "/h/missing"
+		}
+	})
+	mu := sync.Mutex{}
+	var failures []string
+	fake.Handle(string(ActionDownloaderFailreport), func(add string) string {
+		defer mu.Unlock()
+		mu.Lock()
+		failures = append(failures, add)
+		return "OK\n"
+	})
+
+	root := t.TempDir()
+	downloadDir := filepath.Join(root, "downloads")
+	g := NewGalleryDownloader(DownloaderConf{DownloadDir: downloadDir}, c)
+	if err := g.drainQueue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{"001.jpg": "page one", "003.jpg": "page two"} {
+		out, err := os.ReadFile(filepath.Join(downloadDir, "Test [1]", name))
+		if err != nil || string(out) != data {
+			t.Fatalf("unexpected file %s: %q, %v", name, out, err)
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Fatalf("files should not escape download dir: %v", entries)
+	}
+	if p := g.Progress(); p.Downloaded != 2 || p.Failed != 1 || p.Galleries != 1 {
+		t.Fatalf("unexpected progress: %+v", p)
+	}
+	if len(failures) != 1 || !strings.HasSuffix(failures[0], "-103-org") {
+		t.Fatalf("failed source should be reported: %v", failures)
+	}
+}
@@ -0,0 +1,104 @@
+package hathtest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"sync"
+	"time"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// certAuthority root and intermediate ca, the leaf cert is issued by
+//	intermediate ca like h@h does.
+type certAuthority struct {
+	mu sync.Mutex
+
+	host         string
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	interKey     crypto.Signer
+	// validity of leaf certs issued later
+	validity time.Duration
+	serial   int64
+}
+
+func newCertAuthority(clientID string) *certAuthority {
+	ca := &certAuthority{
+		host:     clientID + ".hath.network",
+		validity: 365 * 24 * time.Hour,
+	}
+	rootKey := mustKey()
+	ca.root = ca.mustIssue("hathtest root", rootKey.Public(), nil, rootKey, true, 10*365*24*time.Hour)
+	ca.interKey = mustKey()
+	ca.intermediate = ca.mustIssue("hathtest intermediate", ca.interKey.Public(), ca.root, rootKey, true, 5*365*24*time.Hour)
+	return ca
+}
+
+func mustKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func (ca *certAuthority) mustIssue(cn string, pub crypto.PublicKey, parent *x509.Certificate, signer crypto.Signer, isCA bool, validity time.Duration) *x509.Certificate {
+	ca.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		tmpl.DNSNames = []string{cn, "*." + cn}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return cert
+}
+
+// pkcs12 issue a new leaf cert, encoded with its key and intermediate cert,
+//	password is client key.
+func (ca *certAuthority) pkcs12(password string) ([]byte, error) {
+	defer ca.mu.Unlock()
+	ca.mu.Lock()
+
+	key := mustKey()
+	leaf := ca.mustIssue(ca.host, key.Public(), ca.intermediate, ca.interKey, false, ca.validity)
+	return pkcs12.Encode(rand.Reader, key, leaf, []*x509.Certificate{ca.intermediate}, password)
+}
+
+// RootCA root of issued certs
+func (s *Server) RootCA() *x509.Certificate {
+	return s.certs.root
+}
+
+// SetCertValidity validity of certs issued later
+func (s *Server) SetCertValidity(d time.Duration) {
+	defer s.certs.mu.Unlock()
+	s.certs.mu.Lock()
+
+	s.certs.validity = d
+}
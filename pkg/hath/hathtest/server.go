@@ -0,0 +1,285 @@
+// Package hathtest fake h@h rpc server, so client and server can be tested offline.
+package hathtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RPCPath same as hath.ClientRPCFile
+const RPCPath = "/15/rpc"
+
+// maxKeyTimeDrift same as hath.MaxKeyTimeDrift
+const maxKeyTimeDrift = 300
+
+// Handler custom response of an rpc action, add is the additional param.
+type Handler func(add string) string
+
+// Server fake rpc server, responses are formed as the real one,
+//	a status line followed by payload lines.
+type Server struct {
+	*httptest.Server
+
+	ClientID  string
+	ClientKey string
+
+	mu sync.Mutex
+	// settings returned by client_login and client_settings
+	settings map[string]string
+	// files served at /h/$fileid, returned by srfetch
+	files map[string][]byte
+	// blacklist returned by get_blacklist
+	blacklist []string
+	handlers  map[string]Handler
+	calls     map[string]int
+	// down hosts respond with 503, see Transport
+	down      map[string]bool
+	hostCalls map[string]int
+	// timeDelta server time = local time + delta
+	timeDelta int64
+
+	certs *certAuthority
+}
+
+// NewServer starts fake rpc server, caller must close it.
+func NewServer(clientID, clientKey string) *Server {
+	s := &Server{
+		ClientID:  clientID,
+		ClientKey: clientKey,
+		settings: map[string]string{
+			"port":           "443",
+			"throttle_bytes": "0",
+			"static_ranges":  "",
+		},
+		files:     make(map[string][]byte),
+		handlers:  make(map[string]Handler),
+		calls:     make(map[string]int),
+		down:      make(map[string]bool),
+		hostCalls: make(map[string]int),
+		certs:     newCertAuthority(clientID),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(RPCPath, s.handleRPC)
+	mux.HandleFunc("/h/", s.handleFile)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// RPCURL endpoint to be passed to hath.WithRPCBaseURL
+func (s *Server) RPCURL() *url.URL {
+	u, _ := url.Parse(s.URL + RPCPath)
+	return u
+}
+
+// Transport sends requests of any host to this server, the requested host
+//	is kept in Host header, it's used to fake multiple rpc servers.
+func (s *Server) Transport() http.RoundTripper {
+	u, _ := url.Parse(s.URL)
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.Host = req.URL.Host
+		req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// SetSetting key of client settings, e.g. static_ranges, rpc_server_ip
+func (s *Server) SetSetting(key, value string) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	s.settings[key] = value
+}
+
+// SetTimeDelta clock skew of server
+func (s *Server) SetTimeDelta(d time.Duration) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	s.timeDelta = int64(d.Seconds())
+}
+
+// AddFile serve data as hv file, returns its file id.
+func (s *Server) AddFile(data []byte, ext string) string {
+	sum := sha1.Sum(data)
+	fileID := fmt.Sprintf("%s-%v-100-100-%s", hex.EncodeToString(sum[:]), len(data), ext)
+
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	s.files[fileID] = data
+	return fileID
+}
+
+// SetBlacklist ...
+func (s *Server) SetBlacklist(fileIDs ...string) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	s.blacklist = fileIDs
+}
+
+// Handle override response of action
+func (s *Server) Handle(act string, h Handler) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	s.handlers[act] = h
+}
+
+// SetHostDown requests sent to host via Transport fail with 503
+func (s *Server) SetHostDown(host string, down bool) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	s.down[host] = down
+}
+
+// HostCalls number of rpc calls received by host via Transport
+func (s *Server) HostCalls(host string) int {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	return s.hostCalls[host]
+}
+
+// Calls number of received calls of action, including rejected ones.
+func (s *Server) Calls(act string) int {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	return s.calls[act]
+}
+
+// ServerTime ...
+func (s *Server) ServerTime() int64 {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	return time.Now().Unix() + s.timeDelta
+}
+
+func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	act, add := q.Get("act"), q.Get("add")
+
+	s.mu.Lock()
+	s.calls[act]++
+	s.hostCalls[r.Host]++
+	h, ok := s.handlers[act]
+	down := s.down[r.Host]
+	s.mu.Unlock()
+	if down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if ok {
+		fmt.Fprint(w, h(add))
+		return
+	}
+
+	if act == "server_stat" {
+		fmt.Fprintf(w, "OK\nserver_time=%v\nmin_client_build=154\ncur_client_build=154\n", s.ServerTime())
+		return
+	}
+
+	if status := s.authenticate(q); status != "" {
+		fmt.Fprint(w, status)
+		return
+	}
+
+	switch act {
+	case "client_login", "client_settings":
+		s.writeSettings(w)
+	case "get_cert":
+		data, err := s.certs.pkcs12(s.ClientKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	case "srfetch":
+		// $fileindex;$xres;$fileid
+		parts := strings.Split(add, ";")
+		s.writeFileURL(w, parts[len(parts)-1])
+	case "get_blacklist":
+		s.mu.Lock()
+		fmt.Fprintf(w, "OK\n%s\n", strings.Join(s.blacklist, "\n"))
+		s.mu.Unlock()
+	case "fetchqueue":
+		fmt.Fprint(w, "NO_PENDING_DOWNLOADS")
+	case "client_start", "client_stop", "client_suspend", "client_resume",
+		"still_alive", "overload", "dlfails":
+		fmt.Fprint(w, "OK\n")
+	default:
+		fmt.Fprint(w, "INVALID_REQUEST")
+	}
+}
+
+// authenticate returns error status if actkey is invalid
+func (s *Server) authenticate(q url.Values) string {
+	if q.Get("cid") != s.ClientID {
+		return "FAIL_INVALID_CLIENT"
+	}
+	actTime, _ := strconv.ParseInt(q.Get("acttime"), 10, 64)
+	if math.Abs(float64(actTime-s.ServerTime())) > maxKeyTimeDrift {
+		return "KEY_EXPIRED"
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("hentai@home-%s-%s-%s-%s-%s",
+		q.Get("act"), q.Get("add"), s.ClientID, q.Get("acttime"), s.ClientKey)))
+	if hex.EncodeToString(sum[:]) != q.Get("actkey") {
+		return "KEY_EXPIRED"
+	}
+	return ""
+}
+
+func (s *Server) writeSettings(w http.ResponseWriter) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	fmt.Fprint(w, "OK\n")
+	for k, v := range s.settings {
+		fmt.Fprintf(w, "%s=%s\n", k, v)
+	}
+}
+
+func (s *Server) writeFileURL(w http.ResponseWriter, fileID string) {
+	s.mu.Lock()
+	_, ok := s.files[fileID]
+	s.mu.Unlock()
+
+	fmt.Fprint(w, "OK\n")
+	if ok {
+		fmt.Fprintf(w, "%s/h/%s\n", s.URL, fileID)
+	}
+}
+
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	fileID := strings.TrimPrefix(r.URL.Path, "/h/")
+
+	s.mu.Lock()
+	data, ok := s.files[fileID]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,164 @@
+package hath
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// stillAliveInterval the Java client pings the rpc server every ~2 minutes
+	stillAliveInterval = 2 * time.Minute
+	// settingsRefreshInterval settings and server time are re-synced periodically,
+	//	in case refresh_settings server command was missed.
+	settingsRefreshInterval = time.Hour
+	// heartbeatFailureThreshold consecutive failures before the node is considered offline
+	heartbeatFailureThreshold = 3
+)
+
+// HeartbeatStatus ...
+type HeartbeatStatus struct {
+	LastSuccess         time.Time `json:"last_success"`
+	LastFailure         time.Time `json:"last_failure"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastSettingsRefresh time.Time `json:"last_settings_refresh"`
+}
+
+// Healthy node is online from rpc server's view
+func (hs HeartbeatStatus) Healthy() bool {
+	return hs.ConsecutiveFailures < heartbeatFailureThreshold
+}
+
+type heartbeat struct {
+	sync.RWMutex
+	status HeartbeatStatus
+}
+
+// HeartbeatStatus ...
+func (c *Client) HeartbeatStatus() HeartbeatStatus {
+	defer c.heartbeat.RUnlock()
+	c.heartbeat.RLock()
+
+	return c.heartbeat.status
+}
+
+// StillAlive ping rpc server, the server might ask client to refresh settings in response.
+func (c *Client) StillAlive(ctx context.Context) (*RPCResponse, error) {
+	return c.RPCRequestContext(ctx, ActionStillAlive, "")
+}
+
+// KeepAlive sends still_alive periodically until ctx is done. It only returns
+//	error when the server terminated this client, failures are recovered otherwise.
+func (c *Client) KeepAlive(ctx context.Context) error {
+	return c.keepAlive(ctx, stillAliveInterval)
+}
+
+func (c *Client) keepAlive(ctx context.Context, interval time.Duration) error {
+	log := zap.S().Named("heartbeat")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// server doesn't expect pings from suspended client, pings are
+		//	resumed once suspension is over even if auto resume keeps failing.
+		if time.Now().Before(c.SuspendedUntil()) {
+			continue
+		}
+
+		err := c.supervise(func() error {
+			return c.heartbeatOnce(ctx, log)
+		})
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrTermBadNetwork) {
+			log.Errorf("Heartbeat, client is terminated by server: %s", err)
+			return err
+		}
+
+		status := c.HeartbeatStatus()
+		if !status.Healthy() {
+			log.Errorf("Heartbeat, %v consecutive failures, node might be offline: %s", status.ConsecutiveFailures, err)
+		} else {
+			log.Warnf("Heartbeat, failed still alive test, will retry later: %s", err)
+		}
+	}
+}
+
+// supervise recover from panic, keep the loop running
+func (c *Client) supervise(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			c.recordHeartbeat(err)
+		}
+	}()
+	return fn()
+}
+
+// heartbeatOnce returns error of still_alive only, settings refresh failure is
+//	logged and retried next time, it doesn't make the node look offline.
+func (c *Client) heartbeatOnce(ctx context.Context, log *zap.SugaredLogger) error {
+	resp, err := c.StillAlive(ctx)
+	c.recordHeartbeat(err)
+	if err != nil {
+		return err
+	}
+
+	// refresh settings if server asks, or it's stale
+	_, asked := resp.Payload.KeyValues()["refresh_settings"]
+	if !asked {
+		for _, line := range resp.Payload {
+			asked = asked || line == "refresh_settings"
+		}
+	}
+	if asked || time.Since(c.HeartbeatStatus().LastSettingsRefresh) > settingsRefreshInterval {
+		if err := c.refreshSettings(ctx); err != nil {
+			log.Warnf("Heartbeat, failed to refresh settings, will retry later: %s", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) refreshSettings(ctx context.Context) error {
+	if err := c.SyncTimeDelta(ctx); err != nil {
+		return errors.Wrap(err, "sync time delta")
+	}
+	if _, err := c.FetchRemoteSettings(ctx, true); err != nil {
+		return errors.Wrap(err, "refresh settings")
+	}
+	return nil
+}
+
+func (c *Client) settingsRefreshed() {
+	defer c.heartbeat.Unlock()
+	c.heartbeat.Lock()
+
+	c.heartbeat.status.LastSettingsRefresh = time.Now()
+}
+
+func (c *Client) recordHeartbeat(err error) {
+	defer c.heartbeat.Unlock()
+	c.heartbeat.Lock()
+
+	now := time.Now()
+	if err != nil {
+		c.heartbeat.status.LastFailure = now
+		c.heartbeat.status.LastError = err.Error()
+		c.heartbeat.status.ConsecutiveFailures++
+		return
+	}
+	c.heartbeat.status.LastSuccess = now
+	c.heartbeat.status.ConsecutiveFailures = 0
+}
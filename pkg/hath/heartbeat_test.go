@@ -0,0 +1,62 @@
+package hath
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func TestClient_KeepAlive(t *testing.T) {
+	c, fake := testClient(t)
+
+	// suspended client doesn't ping
+	c.suspension.until = time.Now().Add(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.keepAlive(ctx, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.Calls(string(ActionStillAlive)); n != 0 {
+		t.Fatalf("suspended client should skip heartbeat, calls: %v", n)
+	}
+
+	// suspension is over though auto resume failed
+	c.suspension.until = time.Now().Add(-time.Minute)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.keepAlive(ctx, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.Calls(string(ActionStillAlive)); n == 0 {
+		t.Fatal("heartbeat should be sent after suspension is over")
+	}
+
+	// terminated by server
+	c.suspension.until = time.Time{}
+	fake.Handle(string(ActionStillAlive), func(add string) string { return "TERM_BAD_NETWORK" })
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.keepAlive(ctx, 5*time.Millisecond); !errors.Is(err, ErrTermBadNetwork) {
+		t.Fatalf("bad network should be fatal, got: %v", err)
+	}
+}
+
+func TestClient_HeartbeatSettingsFailure(t *testing.T) {
+	c, fake := testClient(t)
+	fake.Handle(string(ActionStillAlive), func(add string) string { return "OK\nrefresh_settings" })
+	fake.Handle(string(ActionClientSettings), func(add string) string { return "FAIL" })
+
+	// still_alive succeeded, failed refresh doesn't count as heartbeat failure
+	if err := c.heartbeatOnce(context.Background(), zap.S()); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.HeartbeatStatus(); status.ConsecutiveFailures != 0 || status.LastSuccess.IsZero() {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if n := fake.Calls(string(ActionClientSettings)); n == 0 {
+		t.Fatal("settings should be refreshed when server asks")
+	}
+}
@@ -1,6 +1,8 @@
 package hath
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"strings"
 
@@ -17,8 +19,6 @@ type HVFile struct {
 	Size int    `json:"size"`
 	Xres int    `json:"xres"`
 	Yres int    `json:"yres"`
-
-	Data []byte `json:"-"`
 }
 
 // NewHVFileFromFileID ...
@@ -41,6 +41,18 @@ func (f *HVFile) FileID() string {
 	return fmt.Sprintf("%s-%v-%v-%v-%s", f.Hash, f.Size, f.Xres, f.Yres, f.Type)
 }
 
+// Verify check data matches size and SHA-1 hash of file.
+func (f *HVFile) Verify(data []byte) error {
+	if len(data) != f.Size {
+		return fmt.Errorf("size mismatch, expected: %v, got: %v", f.Size, len(data))
+	}
+	sum := sha1.Sum(data)
+	if hash := hex.EncodeToString(sum[:]); hash != f.Hash {
+		return fmt.Errorf("hash mismatch, expected: %s, got: %s", f.Hash, hash)
+	}
+	return nil
+}
+
 // MIMEType MIME Type
 func (f *HVFile) MIMEType() string {
 	switch f.Type {
@@ -49,7 +61,7 @@ func (f *HVFile) MIMEType() string {
 	case "png":
 		return ContentTypePNG
 	case "gif":
-		return ContentTypeWEBM
+		return ContentTypeGIF
 	case "wbm":
 		return ContentTypeWEBM
 	default:
@@ -0,0 +1,60 @@
+package hath
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// HV request results
+const (
+	hvResultHit   = "hit"
+	hvResultProxy = "proxy"
+	hvResultMiss  = "miss"
+)
+
+var (
+	hvRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hath_hv_requests_total",
+		Help: "HV file requests by result, hit: served from cache, proxy: fetched from upstream, miss: not found.",
+	}, []string{"result"})
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "hath_rpc_duration_seconds",
+		Help: "RPC call latency by action and host.",
+	}, []string{"action", "host"})
+
+	cacheSizeDesc  = prometheus.NewDesc("hath_cache_size_bytes", "Total bytes of cached files.", nil, nil)
+	cacheFilesDesc = prometheus.NewDesc("hath_cache_files", "Number of cached files.", nil, nil)
+	certExpiryDesc = prometheus.NewDesc("hath_cert_expiry_timestamp_seconds", "Expiry unix time of TLS certificate.", nil, nil)
+	galleryDesc    = prometheus.NewDesc("hath_downloader_files", "Files of gallery being downloaded by state, total, downloaded or failed.", []string{"state"}, nil)
+)
+
+// serverCollector gauges read from server on scrape
+type serverCollector struct {
+	s *Server
+}
+
+func (c serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheSizeDesc
+	ch <- cacheFilesDesc
+	ch <- certExpiryDesc
+	ch <- galleryDesc
+}
+
+func (c serverCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, float64(c.s.Stor.CacheSize()))
+	ch <- prometheus.MustNewConstMetric(cacheFilesDesc, prometheus.GaugeValue, float64(c.s.Stor.FileCount()))
+	if notAfter := c.s.HC.Certificate.NotAfter(); !notAfter.IsZero() {
+		ch <- prometheus.MustNewConstMetric(certExpiryDesc, prometheus.GaugeValue, float64(notAfter.Unix()))
+	}
+	p := c.s.GD.Progress()
+	ch <- prometheus.MustNewConstMetric(galleryDesc, prometheus.GaugeValue, float64(p.FileCount), "total")
+	ch <- prometheus.MustNewConstMetric(galleryDesc, prometheus.GaugeValue, float64(p.Downloaded), "downloaded")
+	ch <- prometheus.MustNewConstMetric(galleryDesc, prometheus.GaugeValue, float64(p.Failed), "failed")
+}
+
+// registerMetrics only one server is exported in a process
+func (s *Server) registerMetrics() {
+	if err := prometheus.Register(serverCollector{s: s}); err != nil {
+		s.logger.Warnf("Metrics, register server metrics: %s", err)
+	}
+}
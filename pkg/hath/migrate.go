@@ -0,0 +1,114 @@
+package hath
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/mayocream/hath-go/pkg/hath/util"
+)
+
+// MigrateOptions ...
+type MigrateOptions struct {
+	// Verify check SHA-1 of every file, mismatched files are not copied.
+	Verify bool
+	// ProgressInterval report progress every n scanned files
+	ProgressInterval int64
+	// Progress called with stats so far
+	Progress func(stats MigrateStats)
+}
+
+// MigrateStats ...
+type MigrateStats struct {
+	Scanned int64 `json:"scanned"`
+	Copied  int64 `json:"copied"`
+	// Skipped files already exist in destination
+	Skipped int64 `json:"skipped"`
+	// Invalid files with malformed id or mismatched content
+	Invalid int64 `json:"invalid"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// MigrateStorage copy every file from src to dst. Files already in dst are skipped,
+//	so an interrupted migration can be resumed by running it again.
+func MigrateStorage(ctx context.Context, src, dst Storage, opt MigrateOptions) (MigrateStats, error) {
+	var stats MigrateStats
+	log := zap.S().Named("migrate")
+
+	err := src.Walk(func(fileID string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stats.Scanned++
+		if opt.Progress != nil && opt.ProgressInterval > 0 && stats.Scanned%opt.ProgressInterval == 0 {
+			opt.Progress(stats)
+		}
+
+		if !util.ValidHVFileID(fileID) {
+			log.With("fileID", fileID).Warn("Migrate, invalid file id.")
+			stats.Invalid++
+			return nil
+		}
+		hv, err := NewHVFileFromFileID(fileID)
+		if err != nil {
+			return err
+		}
+
+		exists, err := dst.HasHVFile(hv)
+		if err != nil {
+			return errors.Wrap(err, "check destination")
+		}
+		if exists {
+			stats.Skipped++
+			return nil
+		}
+
+		if err := copyHVFile(src, dst, hv, opt.Verify); err != nil {
+			if errors.Is(err, ErrCorrupted) || errors.Is(err, ErrNotFound) {
+				log.With("fileID", fileID).Warnf("Migrate, skip file: %s", err)
+				stats.Invalid++
+				return nil
+			}
+			return errors.Wrap(err, fileID)
+		}
+		stats.Copied++
+		stats.Bytes += int64(hv.Size)
+		return nil
+	})
+	if opt.Progress != nil {
+		opt.Progress(stats)
+	}
+
+	return stats, err
+}
+
+// copyHVFile stream file content from src to dst
+func copyHVFile(src, dst Storage, hv *HVFile, verify bool) error {
+	r, err := src.GetHVFile(hv)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := dst.CreateHVFile(hv)
+	if err != nil {
+		return err
+	}
+
+	h := sha1.New()
+	n, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	if verify && (n != int64(hv.Size) || hex.EncodeToString(h.Sum(nil)) != hv.Hash) {
+		w.Abort()
+		return ErrCorrupted
+	}
+
+	return w.Commit()
+}
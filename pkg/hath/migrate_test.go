@@ -0,0 +1,52 @@
+package hath
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateStorage(t *testing.T) {
+	dir := t.TempDir()
+	src, err := NewStorage(StorageConf{Backend: StorageBackendFilesystem, CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst := testStorage(t)
+
+	data, good := testHVData(t)
+	bad := testHVFile(t, 1, len(data))
+	for _, hv := range []*HVFile{good, bad} {
+		if err := src.PutHVFile(hv, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "not-a-file-id"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := MigrateStorage(context.Background(), src, dst, MigrateOptions{Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Scanned != 3 || stats.Copied != 1 || stats.Invalid != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if ok, _ := dst.HasHVFile(good); !ok {
+		t.Fatal("verified file should be copied")
+	}
+	if ok, _ := dst.HasHVFile(bad); ok {
+		t.Fatal("corrupted file should not be copied")
+	}
+
+	// resume
+	stats, err = MigrateStorage(context.Background(), src, dst, MigrateOptions{Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied != 0 || stats.Skipped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,144 @@
+package hath
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// certClockSkew cert issued just now is accepted even if local clock is behind the issuer
+const certClockSkew = 5 * time.Minute
+
+// parsePKCS12Chain tls cert from pkcs12 bundle, the leaf is the cert matching private key,
+//	followed by intermediates ordered towards the root. Self-signed roots only
+//	verify the chain, they are not served, certs not in the chain are ignored.
+//	Validity is checked at now, allowing certClockSkew before NotBefore.
+func parsePKCS12Chain(data []byte, password string, now time.Time) (*tls.Certificate, error) {
+	// We should using pkcs12 topem method to remove unsupported tags
+	// 	password is used to decode.
+	// ref: https://github.com/golang/go/issues/23499#issuecomment-367849407
+	// It's a workaround for golang pkcs12 package is only for a single file
+	// 	contains only one key and one certificate.
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return nil, errors.Wrap(err, "pkcs12 decode")
+	}
+
+	var certs []*x509.Certificate
+	var key crypto.Signer
+	for i, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse cert of bag %v", i)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			if key != nil {
+				return nil, errors.New("pkcs12 contains more than one private key")
+			}
+			if key, err = helpers.ParsePrivateKeyPEM(pem.EncodeToMemory(block)); err != nil {
+				return nil, errors.Wrapf(err, "parse key of bag %v", i)
+			}
+		}
+	}
+	if key == nil {
+		return nil, errors.New("pkcs12 contains no private key")
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("pkcs12 contains no certificate")
+	}
+
+	leaf := findLeaf(certs, key.Public())
+	if leaf == nil {
+		return nil, errors.Errorf("private key matches none of %v certs", len(certs))
+	}
+	chain, err := buildChain(leaf, certs)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range chain {
+		if now.Add(certClockSkew).Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return nil, errors.Errorf("cert %q is not valid now, valid from %s to %s",
+				cert.Subject.CommonName, cert.NotBefore, cert.NotAfter)
+		}
+	}
+
+	tlsCert := &tls.Certificate{
+		PrivateKey: key,
+		Leaf:       leaf,
+	}
+	for _, cert := range chain {
+		tlsCert.Certificate = append(tlsCert.Certificate, cert.Raw)
+	}
+	return tlsCert, nil
+}
+
+// findLeaf cert of public key, end-entity cert is preferred
+func findLeaf(certs []*x509.Certificate, pub crypto.PublicKey) *x509.Certificate {
+	key, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil
+	}
+	var leaf *x509.Certificate
+	for _, cert := range certs {
+		if !key.Equal(cert.PublicKey) {
+			continue
+		}
+		if !cert.IsCA {
+			return cert
+		}
+		leaf = cert
+	}
+	return leaf
+}
+
+// buildChain follow issuers from leaf until a root or a cert issued outside the bundle
+func buildChain(leaf *x509.Certificate, certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	chain := []*x509.Certificate{leaf}
+	used := map[*x509.Certificate]bool{leaf: true}
+
+	for cur := leaf; !isSelfSigned(cur); {
+		issuer, err := findIssuer(cur, certs, used)
+		if err != nil {
+			return nil, err
+		}
+		// issuer is trusted by clients
+		if issuer == nil || isSelfSigned(issuer) {
+			break
+		}
+		used[issuer] = true
+		chain = append(chain, issuer)
+		cur = issuer
+	}
+	return chain, nil
+}
+
+// findIssuer unused cert which signed cert, nil if not in the bundle
+func findIssuer(cert *x509.Certificate, certs []*x509.Certificate, used map[*x509.Certificate]bool) (*x509.Certificate, error) {
+	var lastErr error
+	for _, c := range certs {
+		if used[c] || !bytes.Equal(c.RawSubject, cert.RawIssuer) {
+			continue
+		}
+		if lastErr = cert.CheckSignatureFrom(c); lastErr == nil {
+			return c, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, errors.Wrapf(lastErr, "verify cert %q signed by %q", cert.Subject.CommonName, cert.Issuer.CommonName)
+	}
+	return nil, nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
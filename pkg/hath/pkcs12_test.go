@@ -0,0 +1,124 @@
+package hath
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+type testIssued struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// testIssue cert signed by parent, it's self-signed if parent is nil
+func testIssue(t *testing.T, cn string, parent *testIssued, isCA bool, notAfter time.Time) *testIssued {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	parentCert, signer := tmpl, crypto.Signer(key)
+	if parent != nil {
+		parentCert, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIssued{cert: cert, key: key}
+}
+
+func TestParsePKCS12Chain(t *testing.T) {
+	valid := time.Now().Add(24 * time.Hour)
+	root := testIssue(t, "root", nil, true, valid)
+	inter1 := testIssue(t, "inter1", root, true, valid)
+	inter2 := testIssue(t, "inter2", inter1, true, valid)
+	leaf := testIssue(t, "leaf", inter2, false, valid)
+	expiredInter := testIssue(t, "inter2", inter1, true, time.Now().Add(-time.Minute))
+	expiredLeaf := testIssue(t, "leaf", expiredInter, false, valid)
+	other := testIssue(t, "other", nil, true, valid)
+	// same subject as inter2, but it doesn't sign leaf
+	forged := testIssue(t, "inter2", inter1, true, valid)
+
+	encode := func(key *ecdsa.PrivateKey, leaf *testIssued, cas ...*testIssued) []byte {
+		certs := make([]*x509.Certificate, 0, len(cas))
+		for _, ca := range cas {
+			certs = append(certs, ca.cert)
+		}
+		data, err := pkcs12.Encode(rand.Reader, key, leaf.cert, certs, testClientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// bags are shuffled, unrelated cert is ignored
+	cert, err := parsePKCS12Chain(encode(leaf.key, leaf, other, inter1, root, inter2), testClientKey, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "leaf" {
+		t.Fatalf("unexpected leaf: %s", cert.Leaf.Subject.CommonName)
+	}
+	expected := []*x509.Certificate{leaf.cert, inter2.cert, inter1.cert}
+	if len(cert.Certificate) != len(expected) {
+		t.Fatalf("unexpected chain length: %v", len(cert.Certificate))
+	}
+	for i, c := range expected {
+		if string(cert.Certificate[i]) != string(c.Raw) {
+			t.Fatalf("unexpected cert at %v, expected: %s", i, c.Subject.CommonName)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"key mismatch", encode(other.key, leaf, inter2, inter1)},
+		{"expired intermediate", encode(expiredLeaf.key, expiredLeaf, expiredInter, inter1)},
+		{"invalid signature", encode(leaf.key, leaf, forged, inter1)},
+		{"malformed", []byte("FAIL")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePKCS12Chain(tt.data, testClientKey, time.Now()); err == nil {
+				t.Fatal("bundle should be rejected")
+			} else {
+				t.Log(err)
+			}
+		})
+	}
+
+	if _, err := parsePKCS12Chain(encode(leaf.key, leaf, inter2), "wrong-password", time.Now()); err == nil {
+		t.Fatal("wrong password should be rejected")
+	}
+
+	// local clock is slightly behind the issuer, certs are valid from an hour ago
+	if _, err := parsePKCS12Chain(encode(leaf.key, leaf, inter2, inter1), testClientKey, time.Now().Add(-time.Hour-time.Minute)); err != nil {
+		t.Fatalf("clock skew should be allowed: %s", err)
+	}
+	if _, err := parsePKCS12Chain(encode(leaf.key, leaf, inter2, inter1), testClientKey, time.Now().Add(-2*time.Hour)); err == nil {
+		t.Fatal("cert not yet valid should be rejected")
+	}
+}
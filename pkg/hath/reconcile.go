@@ -0,0 +1,109 @@
+package hath
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ErrReconcileRunning another cache scan is in progress
+var ErrReconcileRunning = errors.New("cache reconcile is running")
+
+// ReconcileResult ...
+type ReconcileResult struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+	// Pruned files with invalid id or out of static ranges
+	Pruned int64 `json:"pruned"`
+	// Corrupted files failed rehash
+	Corrupted int64 `json:"corrupted"`
+}
+
+// ReconcileCache scan cache like the Java client does at startup, files not belonging
+//	to current static ranges are deleted, rehash check SHA-1 of every file.
+func (s *Server) ReconcileCache(ctx context.Context, rehash bool) (ReconcileResult, error) {
+	var result ReconcileResult
+	if !atomic.CompareAndSwapInt32(&s.reconciling, 0, 1) {
+		return result, ErrReconcileRunning
+	}
+	defer atomic.StoreInt32(&s.reconciling, 0)
+
+	s.HC.RemoteSettings.RLock()
+	ranges := len(s.HC.RemoteSettings.StaticRanges)
+	s.HC.RemoteSettings.RUnlock()
+	// settings might not be loaded, don't wipe out the whole cache
+	prune := ranges > 0
+	if !prune {
+		s.logger.Warn("Cache, no static ranges assigned, skip pruning.")
+	}
+
+	s.logger.Infof("Cache, reconcile started, rehash: %v", rehash)
+	err := s.Stor.Walk(func(fileID string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hv, err := NewHVFileFromFileID(fileID)
+		if err != nil {
+			s.logger.With("fileID", fileID).Warn("Cache, invalid file id, skipped.")
+			return nil
+		}
+		log := s.logger.With("fileID", fileID)
+
+		if prune && !s.HC.RemoteSettings.InStaticRange(hv.Hash) {
+			if err := s.Stor.DeleteHVFile(hv); err != nil && !errors.Is(err, ErrNotFound) {
+				return errors.Wrap(err, "prune")
+			}
+			log.Debug("Cache, pruned file out of static ranges.")
+			result.Pruned++
+			return nil
+		}
+
+		if rehash {
+			if err := rehashHVFile(s.Stor, hv); err != nil {
+				if errors.Is(err, ErrNotFound) {
+					return nil
+				}
+				if !errors.Is(err, ErrCorrupted) {
+					return err
+				}
+				dropCorrupted(s.Stor, hv, err)
+				result.Corrupted++
+				return nil
+			}
+		}
+
+		result.Files++
+		result.Bytes += int64(hv.Size)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	s.logger.Infof("Cache, reconcile finished, files: %v, bytes: %v, pruned: %v, corrupted: %v",
+		result.Files, result.Bytes, result.Pruned, result.Corrupted)
+	return result, nil
+}
+
+// rehashHVFile read whole file then check its size and SHA-1
+func rehashHVFile(stor Storage, hv *HVFile) error {
+	r, err := stor.GetHVFile(hv)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h := sha1.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return err
+	}
+	if n != int64(hv.Size) || hex.EncodeToString(h.Sum(nil)) != hv.Hash {
+		return ErrCorrupted
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package hath
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestServer_ReconcileCache(t *testing.T) {
+	stor := testStorage(t)
+
+	data, good := testHVData(t)
+	corrupted, _ := NewHVFileFromFileID(good.Hash[:4] + "0000000000000000000000000000000000000000"[4:] + "-400-100-100-jpg")
+	outOfRange := testHVFile(t, 1, len(data))
+	for _, hv := range []*HVFile{good, corrupted, outOfRange} {
+		if err := stor.PutHVFile(hv, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Server{
+		HC:     &Client{},
+		Stor:   stor,
+		logger: zap.S(),
+	}
+	s.HC.RemoteSettings.StaticRanges = map[string]int{good.Hash[:4]: 1}
+
+	result, err := s.ReconcileCache(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 1 || result.Pruned != 1 || result.Corrupted != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if stor.FileCount() != 1 {
+		t.Fatalf("unexpected file count: %v", stor.FileCount())
+	}
+}
+
+func TestServer_PurgeCache(t *testing.T) {
+	stor := testStorage(t)
+
+	data, _ := testHVData(t)
+	for i := 1; i <= 3; i++ {
+		if err := stor.PutHVFile(testHVFile(t, i, len(data)), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Server{
+		HC:     &Client{},
+		Stor:   stor,
+		logger: zap.S(),
+	}
+	purged, err := s.PurgeCache(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 3 || stor.FileCount() != 0 {
+		t.Fatalf("unexpected purged: %v, file count: %v", purged, stor.FileCount())
+	}
+}
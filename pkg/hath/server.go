@@ -1,8 +1,10 @@
 package hath
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"net"
@@ -26,21 +28,37 @@ func init() {
 
 // Config ...
 type Config struct {
-	Settings    `mapstructure:",squash"`
-	StorageConf `mapstructure:",squash"`
+	Settings       `mapstructure:",squash"`
+	StorageConf    `mapstructure:",squash"`
+	DownloaderConf `mapstructure:",squash"`
+	ServerCmdConf  `mapstructure:",squash"`
+	CertConf       `mapstructure:",squash"`
 }
 
 // Server p2p server
 type Server struct {
 	HC     *Client
 	DL     *Downloader
+	GD     *GalleryDownloader
 	logger *zap.SugaredLogger
-	Stor   *Storage
+	Stor   Storage
+
+	reconciling int32
+	blacklist   blacklist
+
+	cmdConf   ServerCmdConf
+	cmdReplay replayCache
+	certCache *certCache
+
+	startedAt time.Time
+	// ctx background jobs started by requests are cancelled on shutdown
+	ctx context.Context
 }
 
-// NewServer ...
-func NewServer(config Config) (*Server, error) {
-	hc, err := NewClient(config.Settings)
+// NewServer opts are passed to rpc client, ctx cancels startup rpc calls
+//	and background jobs.
+func NewServer(ctx context.Context, config Config, opts ...ClientOption) (*Server, error) {
+	hc, err := NewClient(ctx, config.Settings, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -50,12 +68,19 @@ func NewServer(config Config) (*Server, error) {
 	}
 	dl := NewDownloader()
 	logger := zap.S().Named("hath")
-	return &Server{
-		DL:     dl,
-		HC:     hc,
-		Stor:   stor,
-		logger: logger,
-	}, nil
+	s := &Server{
+		DL:        dl,
+		GD:        NewGalleryDownloader(config.DownloaderConf, hc),
+		HC:        hc,
+		Stor:      stor,
+		logger:    logger,
+		cmdConf:   config.ServerCmdConf,
+		certCache: newCertCache(config.DataDir, config.ClientKey),
+		startedAt: time.Now(),
+		ctx:       ctx,
+	}
+	s.registerMetrics()
+	return s, nil
 }
 
 // ParseRPCRequest only GET/HEAD methods avaliable on rpc call,
@@ -72,16 +97,16 @@ func (s *Server) ParseRPCRequest(req *http.Request) (interface{}, error) {
 	return nil, nil
 }
 
-// HandleHV ...
+// HandleHV returns file meta and its content reader, caller must close the reader.
 //	form: /h/$fileid/$additional/$filename
-func (s *Server) HandleHV(fileID string, addStr string, fileName string) (*HVFile, error) {
+func (s *Server) HandleHV(ctx context.Context, fileID string, addStr string, fileName string) (*HVFile, io.ReadCloser, error) {
 	vars := fmt.Sprintf("fileID: %s, add: %s, fileName: %s", fileID, addStr, fileName)
 
 	add := util.ParseAddition(addStr)
 	hvFile, err := NewHVFileFromFileID(fileID)
 	if err != nil {
 		s.logger.With("fileID", fileID).Warnf("HV, failed to parse FileID, %s", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	keystampRejected := true
@@ -102,101 +127,106 @@ func (s *Server) HandleHV(fileID string, addStr string, fileName string) (*HVFil
 	// 403 Forbidden
 	if keystampRejected {
 		s.logger.With("vars", vars).Warn("HV, keystampRejected, failed to auth request from server.")
-		return nil, NewHTTPErr(http.StatusForbidden, errors.New("keystamp rejected"))
+		return nil, nil, NewHTTPErr(http.StatusForbidden, errors.New("keystamp rejected"))
 	}
 
 	// check params
 	if fileIndex == 0 || xres == "" {
 		s.logger.With("vars", vars).Warn("HV, missing params.")
-		return nil, NewHTTPErr(http.StatusNotFound, errors.New("Invalid or missing arguments"))
+		return nil, nil, NewHTTPErr(http.StatusNotFound, errors.New("Invalid or missing arguments"))
 	}
 
-	hv, err := s.Stor.GetHVFile(hvFile)
+	if s.IsBlacklisted(fileID) {
+		s.logger.With("vars", vars).Warn("HV, file is blacklisted.")
+		return nil, nil, NewHTTPErr(http.StatusNotFound, ErrNotFound)
+	}
+
+	reader, err := s.Stor.GetHVFile(hvFile)
 	if err != nil {
 		// file not exsit on local disk
-		var validStaticRange bool
-		s.HC.RemoteSettings.RLock()
-		_, validStaticRange = s.HC.RemoteSettings.StaticRanges[fileID]
-		s.HC.RemoteSettings.RUnlock()
-		if errors.Is(err, ErrNotFound) && validStaticRange {
+		// corrupted file has been removed, fetch it again like a cache miss
+		if (errors.Is(err, ErrNotFound) || errors.Is(err, ErrCorrupted)) && s.HC.RemoteSettings.InStaticRange(hvFile.Hash) {
 			s.logger.With("vars", vars).Warn("HV, file not exist on local, but in static range, it will be download then return to user agent.")
 			// download it then return
-			urls, err := s.HC.GetStaticRangeFetchURL(cast.ToString(fileIndex), xres, fileID)
+			urls, err := s.HC.GetStaticRangeFetchURL(ctx, cast.ToString(fileIndex), xres, fileID)
 			if err != nil {
 				s.logger.With("fileID", fileID).Errorf("HV, fetch static range url: %s", err)
-				return nil, NewHTTPErr(http.StatusNotFound, err)
+				return nil, nil, NewHTTPErr(http.StatusNotFound, err)
 			}
 			if len(urls) == 0 {
 				s.logger.With("fileID", fileID).Error("HV, fetch static range url: 0 items.")
-				return nil, NewHTTPErr(http.StatusNotFound, ErrNotFound)
+				return nil, nil, NewHTTPErr(http.StatusNotFound, ErrNotFound)
 			}
-			// proxy download
-			data, err := s.DL.MultipleSourcesDownload(urls, hvFile)
+			// proxy download, bytes are sent to client before they can be verified,
+			//	only the cached copy is verified, see teeCacheReader.
+			body, err := s.DL.MultipleSourcesStream(ctx, urls, hvFile)
 			if err != nil {
 				s.logger.With("fileID", fileID).Errorf("HV, proxy download failed: %s", err)
-				return nil, NewHTTPErr(http.StatusNotFound, err)
+				return nil, nil, NewHTTPErr(http.StatusNotFound, err)
 			}
-			hvFile.Data = data
-			s.logger.With("vars", vars).Info("HV, successful download file data: %v bytes.", len(data))
-			return hvFile, nil
+			s.logger.With("vars", vars).Info("HV, proxy file data from upstream.")
+			hvRequests.WithLabelValues(hvResultProxy).Inc()
+			w, err := s.Stor.CreateHVFile(hvFile)
+			if err != nil {
+				// still serve it without caching
+				s.logger.With("fileID", fileID).Errorf("HV, create cache file: %s", err)
+				return hvFile, body, nil
+			}
+			return hvFile, newTeeCacheReader(body, hvFile, w, s.logger), nil
 		}
 		s.logger.With("vars", vars).Warn("HV, file not exist on local, and it's not in static range, 404 code.")
-		return nil, NewHTTPErr(http.StatusNotFound, ErrNotFound)
+		hvRequests.WithLabelValues(hvResultMiss).Inc()
+		return nil, nil, NewHTTPErr(http.StatusNotFound, ErrNotFound)
 	}
 	s.logger.With("vars", vars).Info("HV, hit local hv file data.")
-	return hv, nil
+	hvRequests.WithLabelValues(hvResultHit).Inc()
+	return hvFile, reader, nil
 }
 
-// HandleTest ...
+// HandleTest returns reader of random bytes and its size.
 // 	form: /t/$testsize/$testtime/$testkey
-func (s *Server) HandleTest(sizeStr, timeStr, key string) ([]byte, error) {
+func (s *Server) HandleTest(sizeStr, timeStr, key string) (io.Reader, int, error) {
 	vars := fmt.Sprintf("size: %s, time: %s, key: %s", sizeStr, timeStr, key)
 
-	s.logger.With("params", vars).Infof("TestCmd, %s random bytes will be generated.", sizeStr)
-
 	size := cast.ToInt(sizeStr)
-	// srvTime := cast.ToInt(timeStr)
-	// TODO auth
-	buf := make([]byte, size)
-	_, err := rand.Read(buf)
-	if err != nil {
-		s.logger.With("params", vars).Errorf("TestCmd, failed to generate bytes: %s", err)
-		return nil, err
+	testTime := cast.ToInt(timeStr)
+
+	exptKey := util.SHA1(fmt.Sprintf("hentai@home-speedtest-%s-%s-%s-%s",
+		cast.ToString(size), cast.ToString(testTime), cast.ToString(s.HC.ClientID), s.HC.ClientKey))
+	if exptKey != key {
+		s.logger.With("params", vars).Warn("TestCmd, invalid key.")
+		return nil, 0, NewHTTPErr(http.StatusForbidden, errors.New("invalid key"))
 	}
+	if math.Abs(float64(testTime-s.HC.correctedTime())) > MaxKeyTimeDrift {
+		s.logger.With("params", vars).Warn("TestCmd, key expired.")
+		return nil, 0, NewHTTPErr(http.StatusForbidden, errors.New("key expired"))
+	}
+	if size <= 0 || size > MaxSpeedTestSize {
+		s.logger.With("params", vars).Warn("TestCmd, invalid size.")
+		return nil, 0, NewHTTPErr(http.StatusForbidden, errors.New("invalid size"))
+	}
+
+	s.logger.With("params", vars).Infof("TestCmd, %v random bytes will be generated.", size)
 
-	return buf, nil
+	return &randReader{n: int64(size)}, size, nil
 }
 
 // HandleHathCmd ...
 // TODO translate into general struct, to support Fiber web framework.
 //	form: /servercmd/$command/$additional/$time/$key
-func (s *Server) HandleHathCmd(serverIP, cmd, add, serverTime, key string) ([]byte, error) {
+func (s *Server) HandleHathCmd(ctx context.Context, serverIP, cmd, add, serverTime, key string) ([]byte, error) {
 	vars := fmt.Sprintf("ip: %s, cmd: %s, add: %s, time: %s, key: %s", serverIP, cmd, add, serverTime, key)
 
-	srvTime := cast.ToInt(serverTime)
-	// only allow API Server rquests
 	ip := net.ParseIP(serverIP)
 
 	s.logger.With("params", vars, "ip", ip).Info("ServerCmd, received event.")
 
-	// We might not check source ip for it alreay contains hash digital sign.
-	// s.HC.RPCServers.RLock()
-	// if _, ok := s.HC.RPCServers.Hosts[ip.String()]; !ok {
-	// 	s.HC.RPCServers.RUnlock()
-	// 	w.WriteHeader(http.StatusForbidden)
-	// 	s.logger.With("params", vars, "ip", ip).Warn("ServerCmd, unknown IP.")
-	// 	return
-	// }
-	// s.HC.RPCServers.RUnlock()
-
-	exptKey := util.SHA1(fmt.Sprintf("hentai@home-servercmd-%s-%s-%s-%s-%s",
-		cmd, add, cast.ToString(s.HC.ClientID), cast.ToString(srvTime), s.HC.ClientKey))
-	if (srvTime-util.SystemTime()) > MaxKeyTimeDrift || exptKey != key {
-		s.logger.With("params", vars, "ip", ip).Warn("ServerCmd, invalid request.")
-		return nil, NewHTTPErr(http.StatusForbidden, errors.New("invalid ke"))
+	if err := s.authServerCmd(ip, cmd, add, serverTime, key); err != nil {
+		s.logger.With("params", vars, "ip", ip).Warnf("ServerCmd, rejected: %s", err)
+		return nil, err
 	}
 
-	result, err := s.execAPICmd(cmd, add)
+	result, err := s.execAPICmd(ctx, cmd, add)
 	if err != nil {
 		s.logger.With("params", vars, "ip", ip).Errorf("ServerCmd, exec: %s", err)
 		return nil, NewHTTPErr(http.StatusBadRequest, err)
@@ -205,7 +235,7 @@ func (s *Server) HandleHathCmd(serverIP, cmd, add, serverTime, key string) ([]by
 	return result, nil
 }
 
-func (s *Server) execAPICmd(cmd string, add string) ([]byte, error) {
+func (s *Server) execAPICmd(ctx context.Context, cmd string, add string) ([]byte, error) {
 	addParams := util.ParseAddition(add)
 
 	switch cmd {
@@ -213,7 +243,7 @@ func (s *Server) execAPICmd(cmd string, add string) ([]byte, error) {
 	case "still_alive":
 		return []byte("I feel FANTASTIC and I'm still alive"), nil
 	case "threaded_proxy_test":
-		result, err := s.execDownloadTest(addParams)
+		result, err := s.execDownloadTest(ctx, addParams)
 		if err != nil {
 			return nil, err
 		}
@@ -231,15 +261,15 @@ func (s *Server) execAPICmd(cmd string, add string) ([]byte, error) {
 		}
 		return buf, nil
 	case "refresh_settings":
-		s.HC.FetchRemoteSettings(true)
+		if err := s.RefreshSettings(ctx); err != nil {
+			return nil, err
+		}
 	case "start_downloader":
-		// ignore it, we will init Download at started.
+		s.GD.Trigger()
 	case "refresh_certs":
-		tlsCert, err := s.HC.GetTLSCertificate()
-		if err != nil {
+		if err := s.RefreshCertificate(ctx); err != nil {
 			return nil, err
 		}
-		s.HC.Certificate.StoreCertificate(tlsCert)
 	default:
 		return []byte("INVALID_COMMAND"), errors.New("invalid command")
 	}
@@ -247,7 +277,7 @@ func (s *Server) execAPICmd(cmd string, add string) ([]byte, error) {
 	return nil, nil
 }
 
-func (s *Server) execDownloadTest(add map[string]string) ([]byte, error) {
+func (s *Server) execDownloadTest(ctx context.Context, add map[string]string) ([]byte, error) {
 	host := add["hostname"] + ":" + add["port"]
 	protocol := add["protocol"]
 	// default scheme
@@ -272,7 +302,7 @@ func (s *Server) execDownloadTest(add map[string]string) ([]byte, error) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			duration, err := s.DL.DiscardDownload(fileURL.String())
+			duration, err := s.DL.DiscardDownload(ctx, fileURL.String())
 			if err != nil {
 				atomic.AddInt64(&totalSuccess, -1)
 				return
@@ -289,13 +319,24 @@ func (s *Server) execDownloadTest(add map[string]string) ([]byte, error) {
 }
 
 // TLSConfig ...
-func (s *Server) TLSConfig() (*tls.Config, error) {
+func (s *Server) TLSConfig(ctx context.Context) (*tls.Config, error) {
 	s.logger.Info("init server tls config")
-	cert, err := s.HC.GetTLSCertificate()
-	if err != nil {
-		return nil, err
+	cert, renew := s.cachedCertificate()
+	switch {
+	case cert != nil && !renew:
+		s.logger.With("notAfter", cert.Leaf.NotAfter).Info("Cert, reuse cached cert.")
+		s.HC.Certificate.StoreCertificate(cert)
+	case cert != nil:
+		// it's still valid, rpc server being unreachable is not fatal
+		if err := s.RefreshCertificate(ctx); err != nil {
+			s.logger.With("notAfter", cert.Leaf.NotAfter).Warnf("Cert, fetch cert failed, use cached one: %s", err)
+			s.HC.Certificate.StoreCertificate(cert)
+		}
+	default:
+		if err := s.RefreshCertificate(ctx); err != nil {
+			return nil, err
+		}
 	}
-	s.HC.Certificate.StoreCertificate(cert)
 	return &tls.Config{
 		MinVersion: tls.VersionTLS12,
 		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
@@ -304,6 +345,76 @@ func (s *Server) TLSConfig() (*tls.Config, error) {
 	}, nil
 }
 
+// Run background jobs until ctx is done, returns error if
+//	the client can't keep running, e.g. terminated by server.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	var fatal error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := s.HC.KeepAlive(ctx); err != nil {
+			fatal = err
+			// stop other jobs
+			cancel()
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runPeriodically(ctx, blacklistInterval, func() {
+			if err := s.SyncBlacklist(ctx); err != nil {
+				s.logger.Errorf("Blacklist, %s", err)
+			}
+		})
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.GD.Run(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.WatchCertificate(ctx)
+	}()
+
+	wg.Wait()
+	return fatal
+}
+
+// runPeriodically run fn immediately, then every interval until ctx is done
+func runPeriodically(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// NotifyStarted notify h@h server with cache usage
+func (s *Server) NotifyStarted(ctx context.Context) error {
+	return s.HC.NotifyStarted(ctx, s.Stor.FileCount(), s.Stor.CacheSize())
+}
+
+// Close release resources held by server
+func (s *Server) Close() error {
+	return s.Stor.Close()
+}
+
 // Addr ...
 func (s *Server) Addr() int {
 	return s.HC.RemoteSettings.ServerPort
@@ -0,0 +1,117 @@
+package hath
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/mayocream/hath-go/pkg/hath/util"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func testServer() *Server {
+	return &Server{
+		HC: &Client{
+			Settings: Settings{
+				ClientID:  "12345",
+				ClientKey: "abcdefghijklmnopqrst",
+			},
+		},
+		logger: zap.S(),
+		ctx:    context.Background(),
+	}
+}
+
+// testKeystamp valid keystamp of file for testServer
+func testKeystamp(fileID string) string {
+	now := util.SystemTime()
+	return fmt.Sprintf("%v-%s", now, util.SHA1(fmt.Sprintf("%v-%s-%s-hotlinkthis", now, fileID, testClientKey))[:10])
+}
+
+func TestServer_HandleTest(t *testing.T) {
+	s := testServer()
+	sign := func(size, testTime int) string {
+		return util.SHA1(fmt.Sprintf("hentai@home-speedtest-%v-%v-%s-%s", size, testTime, s.HC.ClientID, s.HC.ClientKey))
+	}
+	now := util.SystemTime()
+
+	tests := []struct {
+		name   string
+		size   int
+		time   int
+		key    string
+		status int
+	}{
+		{"valid", 1000, now, sign(1000, now), 0},
+		{"invalid key", 1000, now, sign(1001, now), http.StatusForbidden},
+		{"expired", 1000, now - MaxKeyTimeDrift - 10, sign(1000, now-MaxKeyTimeDrift-10), http.StatusForbidden},
+		{"too large", MaxSpeedTestSize + 1, now, sign(MaxSpeedTestSize+1, now), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, size, err := s.HandleTest(fmt.Sprint(tt.size), fmt.Sprint(tt.time), tt.key)
+			if tt.status != 0 {
+				var herr *HTTPErr
+				if !errors.As(err, &herr) || herr.Status != tt.status {
+					t.Fatalf("expected status %v, got: %v", tt.status, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := r.(*io.LimitedReader); ok {
+				t.Fatal("limited reader is unwrapped by fasthttp, it must be bounded by itself")
+			}
+			n, _ := io.Copy(io.Discard, r)
+			if size != tt.size || n != int64(tt.size) {
+				t.Fatalf("unexpected size: %v, read: %v", size, n)
+			}
+		})
+	}
+}
+
+func TestServer_HandleHathCmd(t *testing.T) {
+	s := testServer()
+	s.HC.RPCServers.Hosts = map[string]int{"192.0.2.1": 10}
+	sign := func(cmd string, srvTime int) string {
+		return util.SHA1(fmt.Sprintf("hentai@home-servercmd-%s-%s-%s-%v-%s", cmd, "", s.HC.ClientID, srvTime, s.HC.ClientKey))
+	}
+	now := util.SystemTime()
+
+	tests := []struct {
+		name    string
+		enforce bool
+		ip      string
+		time    int
+		key     string
+		err     error
+	}{
+		{"valid", false, "198.51.100.1", now, sign("still_alive", now), nil},
+		{"replayed", false, "198.51.100.1", now, sign("still_alive", now), ErrServerCmdReplayed},
+		{"invalid key", false, "198.51.100.1", now, sign("still_alive", now+1), ErrServerCmdInvalidKey},
+		{"expired", false, "198.51.100.1", now - MaxKeyTimeDrift - 10, sign("still_alive", now-MaxKeyTimeDrift-10), ErrServerCmdExpired},
+		{"future", false, "198.51.100.1", now + MaxKeyTimeDrift + 10, sign("still_alive", now+MaxKeyTimeDrift+10), ErrServerCmdExpired},
+		{"unknown ip", true, "198.51.100.1", now + 1, sign("still_alive", now+1), ErrServerCmdUnknownIP},
+		{"rpc server ip", true, "192.0.2.1", now + 2, sign("still_alive", now+2), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.cmdConf.EnforceRPCServerIP = tt.enforce
+			_, err := s.HandleHathCmd(context.Background(), tt.ip, "still_alive", "", fmt.Sprint(tt.time), tt.key)
+			if tt.err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var herr *HTTPErr
+			if !errors.As(err, &herr) || herr.Status != http.StatusForbidden || !errors.Is(herr.Err, tt.err) {
+				t.Fatalf("expected %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
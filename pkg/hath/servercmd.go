@@ -0,0 +1,81 @@
+package hath
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"github.com/mayocream/hath-go/pkg/hath/util"
+)
+
+// ServerCmdConf ...
+type ServerCmdConf struct {
+	// EnforceRPCServerIP only accept servercmd from rpc server ips,
+	//	commands are signed anyway, it's disabled by default.
+	EnforceRPCServerIP bool `mapstructure:"enforce_rpc_server_ip"`
+}
+
+// servercmd rejections
+var (
+	ErrServerCmdUnknownIP  = errors.New("unknown ip")
+	ErrServerCmdInvalidKey = errors.New("invalid key")
+	ErrServerCmdExpired    = errors.New("key expired")
+	ErrServerCmdReplayed   = errors.New("key replayed")
+)
+
+// replayCache keys of accepted commands, keys older than MaxKeyTimeDrift
+//	are rejected by time check, so they can be forgotten.
+type replayCache struct {
+	sync.Mutex
+	// keys key => server time of command
+	keys map[string]int
+}
+
+// seen record key, returns true if it was already recorded.
+func (rc *replayCache) seen(key string, srvTime, now int) bool {
+	defer rc.Unlock()
+	rc.Lock()
+
+	if rc.keys == nil {
+		rc.keys = make(map[string]int)
+	}
+	for k, t := range rc.keys {
+		if now-t > MaxKeyTimeDrift {
+			delete(rc.keys, k)
+		}
+	}
+
+	if _, ok := rc.keys[key]; ok {
+		return true
+	}
+	rc.keys[key] = srvTime
+	return false
+}
+
+// authServerCmd check source ip, signature, time drift and replay of servercmd.
+func (s *Server) authServerCmd(ip net.IP, cmd, add, serverTime, key string) error {
+	if s.cmdConf.EnforceRPCServerIP && (ip == nil || !s.HC.RPCServers.IsRPCServer(ip.String())) {
+		return NewHTTPErr(http.StatusForbidden, ErrServerCmdUnknownIP)
+	}
+
+	srvTime := cast.ToInt(serverTime)
+	exptKey := util.SHA1(fmt.Sprintf("hentai@home-servercmd-%s-%s-%s-%s-%s",
+		cmd, add, cast.ToString(s.HC.ClientID), cast.ToString(srvTime), s.HC.ClientKey))
+	if exptKey != key {
+		return NewHTTPErr(http.StatusForbidden, ErrServerCmdInvalidKey)
+	}
+
+	now := s.HC.correctedTime()
+	if math.Abs(float64(srvTime-now)) > MaxKeyTimeDrift {
+		return NewHTTPErr(http.StatusForbidden, ErrServerCmdExpired)
+	}
+	if s.cmdReplay.seen(key, srvTime, now) {
+		return NewHTTPErr(http.StatusForbidden, ErrServerCmdReplayed)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package hath
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status snapshot of server state for local inspection
+type Status struct {
+	ClientID  string        `json:"client_id"`
+	StartedAt time.Time     `json:"started_at"`
+	Uptime    time.Duration `json:"uptime"`
+
+	RemoteSettings RemoteSettingsStatus `json:"remote_settings"`
+	RPCHosts       []RPCHostStatus      `json:"rpc_hosts"`
+	Certificate    CertificateStatus    `json:"certificate"`
+	Cache          CacheStatus          `json:"cache"`
+	Downloader     DownloadProgress     `json:"downloader"`
+
+	SuspendedUntil time.Time `json:"suspended_until"`
+}
+
+// RemoteSettingsStatus ...
+type RemoteSettingsStatus struct {
+	ServerPort   int               `json:"server_port"`
+	StaticRanges int               `json:"static_ranges"`
+	Raw          map[string]string `json:"raw"`
+}
+
+// RPCHostStatus weight is the effective weight of balancer
+type RPCHostStatus struct {
+	Host    string `json:"host"`
+	Weight  int64  `json:"weight"`
+	Demoted bool   `json:"demoted"`
+}
+
+// CertificateStatus ...
+type CertificateStatus struct {
+	NotAfter time.Time `json:"not_after"`
+	Valid    bool      `json:"valid"`
+}
+
+// CacheStatus ...
+type CacheStatus struct {
+	Size      int64 `json:"size"`
+	Files     int64 `json:"files"`
+	Corrupted int64 `json:"corrupted"`
+}
+
+// Status ...
+func (s *Server) Status() Status {
+	notAfter := s.HC.Certificate.NotAfter()
+	return Status{
+		ClientID:       s.HC.ClientID,
+		StartedAt:      s.startedAt,
+		Uptime:         time.Since(s.startedAt),
+		RemoteSettings: s.HC.RemoteSettings.status(),
+		RPCHosts:       s.HC.RPCServers.status(),
+		Certificate: CertificateStatus{
+			NotAfter: notAfter,
+			Valid:    s.HC.serverTime().Before(notAfter),
+		},
+		Cache: CacheStatus{
+			Size:      s.Stor.CacheSize(),
+			Files:     s.Stor.FileCount(),
+			Corrupted: s.Stor.CorruptedCount(),
+		},
+		Downloader:     s.GD.Progress(),
+		SuspendedUntil: s.HC.SuspendedUntil(),
+	}
+}
+
+func (rs *RemoteSettings) status() RemoteSettingsStatus {
+	defer rs.RUnlock()
+	rs.RLock()
+
+	raw := make(map[string]string, len(rs.RawSettings))
+	for k, v := range rs.RawSettings {
+		raw[k] = v
+	}
+	return RemoteSettingsStatus{
+		ServerPort:   rs.ServerPort,
+		StaticRanges: len(rs.StaticRanges),
+		Raw:          raw,
+	}
+}
+
+// status hosts sorted by name
+func (rs *RPCServers) status() []RPCHostStatus {
+	defer rs.RUnlock()
+	rs.RLock()
+
+	hosts := make([]RPCHostStatus, 0, len(rs.Hosts))
+	for host := range rs.Hosts {
+		var weight int64
+		if rs.Balancer != nil {
+			weight = rs.Balancer.Weight(host)
+		}
+		hosts = append(hosts, RPCHostStatus{
+			Host:    host,
+			Weight:  weight,
+			Demoted: rs.isDemoted(host),
+		})
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	return hosts
+}
+
+// RefreshSettings fetch remote settings, cache is reconciled in background
+//	as static ranges might be changed.
+func (s *Server) RefreshSettings(ctx context.Context) error {
+	if _, err := s.HC.FetchRemoteSettings(ctx, true); err != nil {
+		return err
+	}
+	// it outlives the request
+	go func() {
+		if _, err := s.ReconcileCache(s.ctx, false); err != nil {
+			s.logger.Errorf("Cache, reconcile: %s", err)
+		}
+	}()
+	return nil
+}
+
+// RefreshCertificate fetch then replace tls cert
+func (s *Server) RefreshCertificate(ctx context.Context) error {
+	tlsCert, err := s.HC.GetTLSCertificate(ctx)
+	if err != nil {
+		return err
+	}
+	s.HC.Certificate.StoreCertificate(tlsCert)
+	s.saveCertificate(tlsCert)
+	return nil
+}
+
+// PurgeCache delete all cached files, it can't run with reconcile.
+func (s *Server) PurgeCache(ctx context.Context) (int64, error) {
+	if !atomic.CompareAndSwapInt32(&s.reconciling, 0, 1) {
+		return 0, ErrReconcileRunning
+	}
+	defer atomic.StoreInt32(&s.reconciling, 0)
+
+	var purged int64
+	err := s.Stor.Walk(func(fileID string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hv, err := NewHVFileFromFileID(fileID)
+		if err != nil {
+			s.logger.With("fileID", fileID).Warn("Cache, invalid file id, skipped.")
+			return nil
+		}
+		if err := s.Stor.DeleteHVFile(hv); err != nil && !errors.Is(err, ErrNotFound) {
+			return errors.Wrap(err, "purge")
+		}
+		purged++
+		return nil
+	})
+
+	s.logger.Infof("Cache, purged %v files.", purged)
+	return purged, err
+}
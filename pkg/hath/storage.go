@@ -1,59 +1,176 @@
 package hath
 
 import (
+	"io"
+	"sync"
+	"time"
+
 	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
 	"go.uber.org/zap"
+)
 
-	"github.com/syndtr/goleveldb/leveldb"
+var (
+	// ErrNotFound ...
+	ErrNotFound = leveldb.ErrNotFound
+	// ErrCorrupted file content doesn't match its hash, it has been removed from cache.
+	ErrCorrupted = errors.New("corrupted hv file")
+)
+
+const (
+	// evictInterval how often the evictor checks cache usage.
+	evictInterval = time.Minute
+	// accessTimeResolution access time won't be rewritten more often than this,
+	//	to avoid turning every cache hit into a disk write.
+	accessTimeResolution = 10 * time.Minute
 )
 
-// ErrNotFound ...
-var ErrNotFound = leveldb.ErrNotFound
+// Storage backends
+const (
+	StorageBackendLevelDB    = "leveldb"
+	StorageBackendFilesystem = "filesystem"
+)
 
 // StorageConf ...
 type StorageConf struct {
-	DBFile string `mapstructure:"db_file"`
+	// Backend leveldb (default) or filesystem
+	Backend string `mapstructure:"storage_backend"`
+	DBFile  string `mapstructure:"db_file"`
+	// CacheDir cache directory of filesystem backend, same layout as the Java client,
+	//	so it can be pointed to an existing Java client's cache.
+	CacheDir string `mapstructure:"cache_dir"`
+	// CacheSizeLimit max bytes of cached files, least recently used files
+	//	will be evicted when exceeded, 0 means unlimited.
+	CacheSizeLimit int64 `mapstructure:"cache_size_limit"`
+	// DiskMinRemainingBytes free disk space reserved, same as the Java client's
+	//	disk_min_remaining_bytes, 0 means disabled.
+	DiskMinRemainingBytes int64 `mapstructure:"disk_min_remaining_bytes"`
+	// VerifyCache check SHA-1 of files on every read, corrupted files
+	//	will be deleted instead of being served.
+	VerifyCache bool `mapstructure:"verify_cache"`
+	// RehashCache check SHA-1 of every cached file at startup, it's slow for large cache.
+	RehashCache bool `mapstructure:"rehash_cache"`
+}
+
+// Storage hv file cache
+type Storage interface {
+	// GetHVFile reader of hvfile content, caller must close it.
+	GetHVFile(hv *HVFile) (io.ReadCloser, error)
+	// CreateHVFile writer to store file content
+	CreateHVFile(hv *HVFile) (HVFileWriter, error)
+	// PutHVFile store file
+	PutHVFile(hv *HVFile, data []byte) error
+	// DeleteHVFile remove file from cache
+	DeleteHVFile(hv *HVFile) error
+	// HasHVFile check file exists without reading it
+	HasHVFile(hv *HVFile) (bool, error)
+	// Walk calls fn with id of every cached file, stops at first error.
+	//	file ids are not validated.
+	Walk(fn func(fileID string) error) error
+	// Evict delete least recently used files until cache is under the limit.
+	Evict() error
+
+	// CacheSize total bytes of cached files
+	CacheSize() int64
+	// FileCount number of cached files
+	FileCount() int64
+	// CorruptedCount number of corrupted files found by read verification
+	CorruptedCount() int64
+
+	// Close stop evictor then release resources
+	Close() error
 }
 
-// Storage ...
-type Storage struct {
-	ldb *leveldb.DB
+// HVFileWriter stages content of a hv file, it's only visible
+//	to readers after Commit.
+type HVFileWriter interface {
+	io.Writer
+	// Commit store staged content
+	Commit() error
+	// Abort discard staged content
+	Abort() error
 }
 
 // NewStorage ...
-func NewStorage(conf StorageConf) (*Storage, error) {
-	zap.S().Infof("open leveldb at: %s", conf.DBFile)
-	db, err := leveldb.OpenFile(conf.DBFile, nil)
-	if err != nil {
-		return nil, err
+func NewStorage(conf StorageConf) (Storage, error) {
+	switch conf.Backend {
+	case "", StorageBackendLevelDB:
+		return newLevelDBStorage(conf)
+	case StorageBackendFilesystem:
+		return newFileStorage(conf)
+	default:
+		return nil, errors.Errorf("unknown storage backend: %s", conf.Backend)
+	}
+}
+
+// dropCorrupted delete file failed read verification
+func dropCorrupted(s Storage, hv *HVFile, reason error) {
+	log := zap.S().With("fileID", hv.FileID())
+	log.Errorf("Storage, corrupted file will be deleted: %s", reason)
+	if err := s.DeleteHVFile(hv); err != nil {
+		log.Errorf("Storage, delete corrupted file: %s", err)
 	}
-	return &Storage{
-		ldb: db,
-	}, nil
 }
 
-// GetHVFile content of hvfile
-func (s *Storage) GetHVFile(hv *HVFile) (*HVFile, error) {
-	data, err := s.ldb.Get([]byte(hv.FileID()), nil)
-	if err != nil {
-		if errors.Is(err, leveldb.ErrNotFound) {
-			return nil, ErrNotFound
+// bytesToFree how many bytes should be evicted to satisfy
+//	cache size limit and reserved disk space, diskShort reports
+//	free disk space is under the reserved.
+func bytesToFree(conf StorageConf, cacheSize int64, path string) (need int64, diskShort bool) {
+	if conf.CacheSizeLimit > 0 {
+		need = cacheSize - conf.CacheSizeLimit
+	}
+	if conf.DiskMinRemainingBytes > 0 {
+		free, err := diskFree(path)
+		if err != nil {
+			zap.S().Warnf("Storage, disk free: %s", err)
+			return need, false
 		}
-		return nil, err
+		lack := conf.DiskMinRemainingBytes - free
+		if lack > need {
+			need = lack
+		}
+		diskShort = lack > 0
 	}
+	return need, diskShort
+}
+
+// evictor runs Evict of storage periodically
+type evictor struct {
+	done chan struct{}
+	wg   sync.WaitGroup
+}
 
-	newHV := &HVFile{
-		Hash: hv.Hash,
-		Type: hv.Type,
-		Size: hv.Size,
-		Xres: hv.Xres,
-		Yres: hv.Yres,
-		Data: data,
+// startEvictor evictor only runs when limits are set
+func startEvictor(conf StorageConf, s Storage) *evictor {
+	e := &evictor{
+		done: make(chan struct{}),
+	}
+	if conf.CacheSizeLimit <= 0 && conf.DiskMinRemainingBytes <= 0 {
+		return e
 	}
-	return newHV, nil
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		ticker := time.NewTicker(evictInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Evict(); err != nil {
+				zap.S().Errorf("Storage, evict: %s", err)
+			}
+			select {
+			case <-e.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return e
 }
 
-// PutHVFile store file
-func (s *Storage) PutHVFile(hv *HVFile, data []byte) error {
-	return s.ldb.Put([]byte(hv.FileID()), data, nil)
+func (e *evictor) stop() {
+	close(e.done)
+	e.wg.Wait()
 }
@@ -0,0 +1,382 @@
+package hath
+
+import (
+	"container/heap"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// tmpFileSuffix staged files, they are removed at startup
+const tmpFileSuffix = ".tmp"
+
+// fileStorage stores files in the Java client's cache layout:
+//	$cache_dir/$hash[0:2]/$hash[2:4]/$fileid
+//	modification time of file is used as its last access time.
+type fileStorage struct {
+	conf StorageConf
+	root string
+
+	// mu guards file creation and removal
+	mu        sync.Mutex
+	cacheSize int64
+	fileCount int64
+	corrupted int64
+
+	evictor *evictor
+}
+
+func newFileStorage(conf StorageConf) (*fileStorage, error) {
+	if conf.CacheDir == "" {
+		return nil, errors.New("missing cache dir")
+	}
+	zap.S().Infof("open cache dir at: %s", conf.CacheDir)
+	if err := os.MkdirAll(conf.CacheDir, 0755); err != nil {
+		return nil, err
+	}
+	s := &fileStorage{
+		conf: conf,
+		root: conf.CacheDir,
+	}
+	if err := s.loadIndex(); err != nil {
+		return nil, errors.Wrap(err, "scan cache dir")
+	}
+	zap.S().Infof("cache loaded, files: %v, size: %v bytes", s.fileCount, s.cacheSize)
+
+	s.evictor = startEvictor(conf, s)
+	return s, nil
+}
+
+// path $cache_dir/$hash[0:2]/$hash[2:4]/$fileid
+func (s *fileStorage) path(hv *HVFile) string {
+	return filepath.Join(s.root, hv.Hash[0:2], hv.Hash[2:4], hv.FileID())
+}
+
+// walkValid calls fn for every valid hv file in cache dir
+func (s *fileStorage) walkValid(fn func(hv *HVFile, path string, info os.FileInfo) error) error {
+	return filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		hv, err := NewHVFileFromFileID(info.Name())
+		if err != nil {
+			return nil
+		}
+		// file misplaced
+		if path != s.path(hv) {
+			return nil
+		}
+		return fn(hv, path, info)
+	})
+}
+
+// loadIndex counts cached files, removes leftover staged files
+func (s *fileStorage) loadIndex() error {
+	return filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(info.Name(), tmpFileSuffix) {
+			return os.Remove(path)
+		}
+		hv, err := NewHVFileFromFileID(info.Name())
+		if err != nil || path != s.path(hv) {
+			return nil
+		}
+		s.fileCount++
+		s.cacheSize += info.Size()
+		return nil
+	})
+}
+
+// GetHVFile ...
+func (s *fileStorage) GetHVFile(hv *HVFile) (io.ReadCloser, error) {
+	path := s.path(hv)
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if s.conf.VerifyCache {
+		if err := verifyFile(f, hv); err != nil {
+			f.Close()
+			atomic.AddInt64(&s.corrupted, 1)
+			dropCorrupted(s, hv, err)
+			return nil, ErrCorrupted
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	s.touch(path)
+	return f, nil
+}
+
+// verifyFile hash whole file before serving it
+func verifyFile(f *os.File, hv *HVFile) error {
+	h := sha1.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if n != int64(hv.Size) {
+		return errors.Errorf("size mismatch, expected: %v, got: %v", hv.Size, n)
+	}
+	if hash := hex.EncodeToString(h.Sum(nil)); hash != hv.Hash {
+		return errors.Errorf("hash mismatch, expected: %s, got: %s", hv.Hash, hash)
+	}
+	return nil
+}
+
+// touch refresh modification time, it's used as last access time.
+func (s *fileStorage) touch(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(info.ModTime()) < accessTimeResolution {
+		return
+	}
+	if err := os.Chtimes(path, now, now); err != nil {
+		zap.S().With("path", path).Warnf("Storage, update access time: %s", err)
+	}
+}
+
+// CreateHVFile ...
+func (s *fileStorage) CreateHVFile(hv *HVFile) (HVFileWriter, error) {
+	path := s.path(hv)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), hv.FileID()+".*"+tmpFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return &fsFileWriter{
+		stor: s,
+		hv:   hv,
+		path: path,
+		f:    f,
+	}, nil
+}
+
+// fsFileWriter writes to a temp file, renamed to the file path on commit.
+type fsFileWriter struct {
+	stor *fileStorage
+	hv   *HVFile
+	path string
+	f    *os.File
+}
+
+func (w *fsFileWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *fsFileWriter) Commit() error {
+	if err := w.f.Close(); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+
+	s := w.stor
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	// usage is counted by size on disk, the same as loadIndex
+	staged, err := os.Stat(w.f.Name())
+	if err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	old, err := os.Stat(w.path)
+	exists := err == nil
+	if err := os.Rename(w.f.Name(), w.path); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	if exists {
+		atomic.AddInt64(&s.cacheSize, staged.Size()-old.Size())
+	} else {
+		atomic.AddInt64(&s.fileCount, 1)
+		atomic.AddInt64(&s.cacheSize, staged.Size())
+	}
+	return nil
+}
+
+func (w *fsFileWriter) Abort() error {
+	w.f.Close()
+	return os.Remove(w.f.Name())
+}
+
+// PutHVFile ...
+func (s *fileStorage) PutHVFile(hv *HVFile, data []byte) error {
+	w, err := s.CreateHVFile(hv)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
+
+// DeleteHVFile ...
+func (s *fileStorage) DeleteHVFile(hv *HVFile) error {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	_, err := s.deleteLocked(s.path(hv))
+	return err
+}
+
+// deleteLocked returns size on disk of removed file
+func (s *fileStorage) deleteLocked(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err == nil {
+		err = os.Remove(path)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	atomic.AddInt64(&s.fileCount, -1)
+	atomic.AddInt64(&s.cacheSize, -info.Size())
+	return info.Size(), nil
+}
+
+// HasHVFile ...
+func (s *fileStorage) HasHVFile(hv *HVFile) (bool, error) {
+	_, err := os.Stat(s.path(hv))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Walk skips staged files and misplaced files, they are not counted
+//	by loadIndex and can't be deleted by file id.
+func (s *fileStorage) Walk(fn func(fileID string) error) error {
+	return filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(info.Name(), tmpFileSuffix) {
+			return nil
+		}
+		if hv, err := NewHVFileFromFileID(info.Name()); err == nil && path != s.path(hv) {
+			return nil
+		}
+		return fn(info.Name())
+	})
+}
+
+// CacheSize ...
+func (s *fileStorage) CacheSize() int64 {
+	return atomic.LoadInt64(&s.cacheSize)
+}
+
+// FileCount ...
+func (s *fileStorage) FileCount() int64 {
+	return atomic.LoadInt64(&s.fileCount)
+}
+
+// CorruptedCount ...
+func (s *fileStorage) CorruptedCount() int64 {
+	return atomic.LoadInt64(&s.corrupted)
+}
+
+// Close ...
+func (s *fileStorage) Close() error {
+	s.evictor.stop()
+	return nil
+}
+
+// Evict scans cache dir, keeps only the oldest files needed to free enough space
+//	in a heap, so memory usage doesn't grow with cache size.
+func (s *fileStorage) Evict() error {
+	need, _ := bytesToFree(s.conf, s.CacheSize(), s.root)
+	if need <= 0 {
+		return nil
+	}
+
+	candidates := &evictHeap{}
+	var total int64
+	err := s.walkValid(func(hv *HVFile, path string, info os.FileInfo) error {
+		heap.Push(candidates, evictEntry{path: path, size: info.Size(), atime: info.ModTime()})
+		total += info.Size()
+		// drop newest while the rest still covers need
+		for total-(*candidates)[0].size >= need {
+			total -= heap.Pop(candidates).(evictEntry).size
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	var freed, count int64
+	for _, e := range *candidates {
+		size, err := s.deleteLocked(e.path)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		freed += size
+		count++
+	}
+
+	zap.S().Infof("Storage, evicted %v files, %v bytes freed.", count, freed)
+	return nil
+}
+
+type evictEntry struct {
+	path  string
+	size  int64
+	atime time.Time
+}
+
+// evictHeap max-heap by access time, newest on top
+type evictHeap []evictEntry
+
+func (h evictHeap) Len() int            { return len(h) }
+func (h evictHeap) Less(i, j int) bool  { return h[i].atime.After(h[j].atime) }
+func (h evictHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *evictHeap) Push(x interface{}) { *h = append(*h, x.(evictEntry)) }
+func (h *evictHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
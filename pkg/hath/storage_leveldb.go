@@ -0,0 +1,364 @@
+package hath
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// leveldb key prefixes of LRU index, file ids always start with a hex digit,
+//	so they won't collide with hv file keys.
+var (
+	// lruAccessPrefix lru/a/$fileid => last access unix time
+	lruAccessPrefix = []byte("lru/a/")
+	// lruOrderPrefix lru/t/$time/$fileid => nil, sorted by access time
+	lruOrderPrefix = []byte("lru/t/")
+)
+
+// levelDBStorage stores files as leveldb values keyed by file id.
+type levelDBStorage struct {
+	conf StorageConf
+	ldb  *leveldb.DB
+
+	// mu guards LRU index updates
+	mu        sync.Mutex
+	cacheSize int64
+	fileCount int64
+	corrupted int64
+
+	evictor *evictor
+}
+
+func newLevelDBStorage(conf StorageConf) (*levelDBStorage, error) {
+	zap.S().Infof("open leveldb at: %s", conf.DBFile)
+	db, err := leveldb.OpenFile(conf.DBFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &levelDBStorage{
+		conf: conf,
+		ldb:  db,
+	}
+	if err := s.loadIndex(); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "load lru index")
+	}
+	zap.S().Infof("cache loaded, files: %v, size: %v bytes", s.fileCount, s.cacheSize)
+
+	s.evictor = startEvictor(conf, s)
+	return s, nil
+}
+
+// loadIndex counts cached files, files stored before the LRU index existed
+//	are treated as accessed now.
+func (s *levelDBStorage) loadIndex() error {
+	now := time.Now()
+	batch := new(leveldb.Batch)
+
+	iter := s.ldb.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		hv, err := NewHVFileFromFileID(string(iter.Key()))
+		if err != nil {
+			// index keys
+			continue
+		}
+		s.fileCount++
+		s.cacheSize += int64(hv.Size)
+
+		if ok, _ := s.ldb.Has(accessKey(hv.FileID()), nil); !ok {
+			putAccessTime(batch, hv.FileID(), now)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return s.ldb.Write(batch, nil)
+}
+
+// GetHVFile reader of hvfile content, caller must close it.
+func (s *levelDBStorage) GetHVFile(hv *HVFile) (io.ReadCloser, error) {
+	data, err := s.ldb.Get([]byte(hv.FileID()), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if s.conf.VerifyCache {
+		if err := hv.Verify(data); err != nil {
+			atomic.AddInt64(&s.corrupted, 1)
+			dropCorrupted(s, hv, err)
+			return nil, ErrCorrupted
+		}
+	}
+
+	if err := s.touch(hv.FileID()); err != nil {
+		zap.S().With("fileID", hv.FileID()).Warnf("Storage, update access time: %s", err)
+	}
+
+	// leveldb can't stream values, data is already in memory
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// CreateHVFile writer to store file content
+func (s *levelDBStorage) CreateHVFile(hv *HVFile) (HVFileWriter, error) {
+	return &ldbFileWriter{
+		stor: s,
+		hv:   hv,
+		buf:  bytes.NewBuffer(make([]byte, 0, hv.Size)),
+	}, nil
+}
+
+// ldbFileWriter buffers content in memory, leveldb values are written at once.
+type ldbFileWriter struct {
+	stor *levelDBStorage
+	hv   *HVFile
+	buf  *bytes.Buffer
+}
+
+func (w *ldbFileWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *ldbFileWriter) Commit() error {
+	return w.stor.PutHVFile(w.hv, w.buf.Bytes())
+}
+
+func (w *ldbFileWriter) Abort() error {
+	w.buf = nil
+	return nil
+}
+
+// PutHVFile store file
+func (s *levelDBStorage) PutHVFile(hv *HVFile, data []byte) error {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	fileID := hv.FileID()
+	exists, err := s.ldb.Has([]byte(fileID), nil)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(fileID), data)
+	if exists {
+		if err := s.moveAccessTime(batch, fileID, time.Now()); err != nil {
+			return err
+		}
+	} else {
+		putAccessTime(batch, fileID, time.Now())
+	}
+	if err := s.ldb.Write(batch, nil); err != nil {
+		return err
+	}
+
+	if !exists {
+		atomic.AddInt64(&s.fileCount, 1)
+		atomic.AddInt64(&s.cacheSize, int64(hv.Size))
+	}
+	return nil
+}
+
+// DeleteHVFile remove file from cache
+func (s *levelDBStorage) DeleteHVFile(hv *HVFile) error {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	return s.deleteLocked(hv.FileID(), int64(hv.Size))
+}
+
+func (s *levelDBStorage) deleteLocked(fileID string, size int64) error {
+	exists, err := s.ldb.Has([]byte(fileID), nil)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete([]byte(fileID))
+	if last, err := s.accessTime(fileID); err == nil {
+		batch.Delete(orderKey(last, fileID))
+	}
+	batch.Delete(accessKey(fileID))
+	if err := s.ldb.Write(batch, nil); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&s.fileCount, -1)
+	atomic.AddInt64(&s.cacheSize, -size)
+	return nil
+}
+
+// HasHVFile ...
+func (s *levelDBStorage) HasHVFile(hv *HVFile) (bool, error) {
+	return s.ldb.Has([]byte(hv.FileID()), nil)
+}
+
+// Walk skips LRU index keys
+func (s *levelDBStorage) Walk(fn func(fileID string) error) error {
+	iter := s.ldb.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if bytes.HasPrefix(iter.Key(), lruAccessPrefix) || bytes.HasPrefix(iter.Key(), lruOrderPrefix) {
+			continue
+		}
+		if err := fn(string(iter.Key())); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// CacheSize ...
+func (s *levelDBStorage) CacheSize() int64 {
+	return atomic.LoadInt64(&s.cacheSize)
+}
+
+// FileCount ...
+func (s *levelDBStorage) FileCount() int64 {
+	return atomic.LoadInt64(&s.fileCount)
+}
+
+// CorruptedCount ...
+func (s *levelDBStorage) CorruptedCount() int64 {
+	return atomic.LoadInt64(&s.corrupted)
+}
+
+// Close stop evictor then close db
+func (s *levelDBStorage) Close() error {
+	s.evictor.stop()
+	return s.ldb.Close()
+}
+
+// touch refresh last access time of file.
+func (s *levelDBStorage) touch(fileID string) error {
+	now := time.Now()
+	if last, err := s.accessTime(fileID); err == nil && now.Sub(last) < accessTimeResolution {
+		return nil
+	}
+
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	// file might be evicted before we got the lock
+	if ok, _ := s.ldb.Has([]byte(fileID), nil); !ok {
+		return nil
+	}
+	batch := new(leveldb.Batch)
+	if err := s.moveAccessTime(batch, fileID, now); err != nil {
+		return err
+	}
+	return s.ldb.Write(batch, nil)
+}
+
+func (s *levelDBStorage) accessTime(fileID string) (time.Time, error) {
+	v, err := s.ldb.Get(accessKey(fileID), nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(v) != 8 {
+		return time.Time{}, errors.New("malformed access time")
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(v)), 0), nil
+}
+
+// moveAccessTime replace old LRU order entry with the new one
+func (s *levelDBStorage) moveAccessTime(batch *leveldb.Batch, fileID string, t time.Time) error {
+	last, err := s.accessTime(fileID)
+	if err == nil {
+		batch.Delete(orderKey(last, fileID))
+	} else if !errors.Is(err, leveldb.ErrNotFound) {
+		return err
+	}
+	putAccessTime(batch, fileID, t)
+	return nil
+}
+
+func putAccessTime(batch *leveldb.Batch, fileID string, t time.Time) {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(t.Unix()))
+	batch.Put(accessKey(fileID), v)
+	batch.Put(orderKey(t, fileID), nil)
+}
+
+func accessKey(fileID string) []byte {
+	return append(append([]byte{}, lruAccessPrefix...), fileID...)
+}
+
+// orderKey fixed width time makes leveldb sort keys by access time
+func orderKey(t time.Time, fileID string) []byte {
+	return append(append([]byte{}, lruOrderPrefix...), fmt.Sprintf("%016x/%s", t.Unix(), fileID)...)
+}
+
+// Evict delete least recently used files until cache is under the limit.
+//	Deleted keys only release disk space after compaction, so db is compacted
+//	when free disk space is short, or it's still short next time. Cache size
+//	is counted by file size, it doesn't need compaction.
+func (s *levelDBStorage) Evict() error {
+	need, diskShort := bytesToFree(s.conf, s.CacheSize(), s.conf.DBFile)
+	if need <= 0 {
+		return nil
+	}
+
+	freed, err := s.evict(need)
+	if err != nil || freed == 0 || !diskShort {
+		return err
+	}
+	if err := s.ldb.CompactRange(lutil.Range{}); err != nil {
+		return errors.Wrap(err, "compact")
+	}
+	return nil
+}
+
+// evict delete least recently used files until need bytes are freed
+func (s *levelDBStorage) evict(need int64) (int64, error) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+
+	var freed, count int64
+	iter := s.ldb.NewIterator(lutil.BytesPrefix(lruOrderPrefix), nil)
+	defer iter.Release()
+	for freed < need && iter.Next() {
+		key := iter.Key()[len(lruOrderPrefix):]
+		// skip $time/
+		if len(key) < 17 {
+			continue
+		}
+		hv, err := NewHVFileFromFileID(string(key[17:]))
+		if err != nil {
+			continue
+		}
+		if err := s.deleteLocked(hv.FileID(), int64(hv.Size)); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				// stale index entry
+				s.ldb.Delete(iter.Key(), nil)
+				continue
+			}
+			return freed, err
+		}
+		freed += int64(hv.Size)
+		count++
+	}
+	if err := iter.Error(); err != nil {
+		return freed, err
+	}
+
+	zap.S().Infof("Storage, evicted %v files, %v bytes freed.", count, freed)
+	return freed, nil
+}
@@ -0,0 +1,251 @@
+package hath
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func testHVFile(t *testing.T, n int, size int) *HVFile {
+	hv, err := NewHVFileFromFileID(fmt.Sprintf("%040x-%v-100-100-jpg", n, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hv
+}
+
+// testStorage leveldb storage in temp dir, it's closed on cleanup
+func testStorage(t *testing.T) Storage {
+	stor, err := NewStorage(StorageConf{DBFile: filepath.Join(t.TempDir(), "hv.ldb")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stor.Close() })
+	return stor
+}
+
+// testHVData content and hv file matching its size and hash
+func testHVData(t *testing.T) ([]byte, *HVFile) {
+	data := bytes.Repeat([]byte("hath"), 100)
+	hv, err := NewHVFileFromFileID(fmt.Sprintf("%x-%v-100-100-jpg", sha1.Sum(data), len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, hv
+}
+
+func TestLevelDBStorage_Evict(t *testing.T) {
+	stor, err := newLevelDBStorage(StorageConf{
+		DBFile: filepath.Join(t.TempDir(), "hv.ldb"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stor.Close()
+
+	files := []*HVFile{testHVFile(t, 1, 100), testHVFile(t, 2, 100), testHVFile(t, 3, 100)}
+	for i, hv := range files {
+		if err := stor.PutHVFile(hv, make([]byte, hv.Size)); err != nil {
+			t.Fatal(err)
+		}
+		// access time has second precision
+		stor.mu.Lock()
+		batch := new(leveldb.Batch)
+		stor.moveAccessTime(batch, hv.FileID(), time.Unix(int64(1000+i), 0))
+		stor.ldb.Write(batch, nil)
+		stor.mu.Unlock()
+	}
+	if stor.FileCount() != 3 || stor.CacheSize() != 300 {
+		t.Fatalf("unexpected usage, files: %v, size: %v", stor.FileCount(), stor.CacheSize())
+	}
+
+	// set limit after files stored, evict manually
+	stor.conf.CacheSizeLimit = 250
+	if err := stor.Evict(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stor.GetHVFile(files[0]); err != ErrNotFound {
+		t.Fatalf("least recently used file should be evicted, got: %v", err)
+	}
+	for _, hv := range files[1:] {
+		if _, err := stor.GetHVFile(hv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stor.FileCount() != 2 || stor.CacheSize() != 200 {
+		t.Fatalf("unexpected usage, files: %v, size: %v", stor.FileCount(), stor.CacheSize())
+	}
+}
+
+func TestBytesToFree(t *testing.T) {
+	dir := t.TempDir()
+	if need, diskShort := bytesToFree(StorageConf{CacheSizeLimit: 250}, 300, dir); need != 50 || diskShort {
+		t.Fatalf("unexpected need: %v, disk short: %v", need, diskShort)
+	}
+	free, err := diskFree(dir)
+	if err != nil {
+		t.Skip(err)
+	}
+	conf := StorageConf{CacheSizeLimit: 250, DiskMinRemainingBytes: free + 1<<30}
+	if need, diskShort := bytesToFree(conf, 300, dir); need < 1<<30 || !diskShort {
+		t.Fatalf("unexpected need: %v, disk short: %v", need, diskShort)
+	}
+}
+
+func TestLevelDBStorage_VerifyCache(t *testing.T) {
+	stor, err := NewStorage(StorageConf{
+		DBFile:      filepath.Join(t.TempDir(), "hv.ldb"),
+		VerifyCache: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stor.Close()
+
+	hv := testHVFile(t, 1, 100)
+	if err := stor.PutHVFile(hv, make([]byte, hv.Size)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stor.GetHVFile(hv); err != ErrCorrupted {
+		t.Fatalf("expected corrupted error, got: %v", err)
+	}
+	if _, err := stor.GetHVFile(hv); err != ErrNotFound {
+		t.Fatalf("corrupted file should be deleted, got: %v", err)
+	}
+	if stor.FileCount() != 0 || stor.CorruptedCount() != 1 {
+		t.Fatalf("unexpected stats, files: %v, corrupted: %v", stor.FileCount(), stor.CorruptedCount())
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	dir := t.TempDir()
+	stor, err := newFileStorage(StorageConf{
+		CacheDir: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []*HVFile{testHVFile(t, 1, 100), testHVFile(t, 2, 100), testHVFile(t, 3, 100)}
+	for i, hv := range files {
+		if err := stor.PutHVFile(hv, make([]byte, hv.Size)); err != nil {
+			t.Fatal(err)
+		}
+		// Java client layout
+		path := filepath.Join(dir, hv.Hash[0:2], hv.Hash[2:4], hv.FileID())
+		atime := time.Unix(int64(1000+i), 0)
+		if err := os.Chtimes(path, atime, atime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// reopen to check cache dir scan
+	stor.Close()
+	stor, err = newFileStorage(StorageConf{
+		CacheDir: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stor.Close()
+	if stor.FileCount() != 3 || stor.CacheSize() != 300 {
+		t.Fatalf("unexpected usage, files: %v, size: %v", stor.FileCount(), stor.CacheSize())
+	}
+
+	stor.conf.CacheSizeLimit = 150
+	if err := stor.Evict(); err != nil {
+		t.Fatal(err)
+	}
+	for i, hv := range files {
+		r, err := stor.GetHVFile(hv)
+		if i < 2 {
+			if err != ErrNotFound {
+				t.Fatalf("least recently used file should be evicted, got: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if len(data) != hv.Size {
+			t.Fatalf("unexpected size: %v", len(data))
+		}
+	}
+	if stor.FileCount() != 1 || stor.CacheSize() != 100 {
+		t.Fatalf("unexpected usage, files: %v, size: %v", stor.FileCount(), stor.CacheSize())
+	}
+}
+
+func TestFileStorage_SizeOnDisk(t *testing.T) {
+	stor, err := newFileStorage(StorageConf{
+		CacheDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stor.Close()
+
+	// truncated file is counted by its size on disk
+	hv := testHVFile(t, 1, 100)
+	if err := stor.PutHVFile(hv, make([]byte, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if stor.CacheSize() != 40 {
+		t.Fatalf("unexpected size: %v", stor.CacheSize())
+	}
+	if err := stor.PutHVFile(hv, make([]byte, hv.Size)); err != nil {
+		t.Fatal(err)
+	}
+	if stor.FileCount() != 1 || stor.CacheSize() != 100 {
+		t.Fatalf("unexpected usage, files: %v, size: %v", stor.FileCount(), stor.CacheSize())
+	}
+	if err := stor.DeleteHVFile(hv); err != nil {
+		t.Fatal(err)
+	}
+	if stor.FileCount() != 0 || stor.CacheSize() != 0 {
+		t.Fatalf("usage should not drift, files: %v, size: %v", stor.FileCount(), stor.CacheSize())
+	}
+}
+
+func TestFileStorage_WalkMisplaced(t *testing.T) {
+	dir := t.TempDir()
+	stor, err := newFileStorage(StorageConf{
+		CacheDir: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stor.Close()
+
+	data, hv := testHVData(t)
+	if err := stor.PutHVFile(hv, data); err != nil {
+		t.Fatal(err)
+	}
+	// copy of a cached file in wrong dir
+	misplaced := testHVFile(t, 1, len(data))
+	if err := os.WriteFile(filepath.Join(dir, misplaced.FileID()), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := testServer()
+	s.Stor = stor
+	purged, err := s.PurgeCache(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 || stor.FileCount() != 0 {
+		t.Fatalf("misplaced file should be skipped, purged: %v, file count: %v", purged, stor.FileCount())
+	}
+}
@@ -0,0 +1,109 @@
+package hath
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"io"
+	"math/rand"
+
+	"go.uber.org/zap"
+)
+
+// teeCacheReader streams upstream body to the client and cache at the same time,
+//	staged content is committed only if size and SHA-1 hash match at EOF.
+type teeCacheReader struct {
+	body io.ReadCloser
+	hv   *HVFile
+	w    HVFileWriter
+	hash hash.Hash
+	n    int
+	log  *zap.SugaredLogger
+}
+
+func newTeeCacheReader(body io.ReadCloser, hv *HVFile, w HVFileWriter, log *zap.SugaredLogger) *teeCacheReader {
+	return &teeCacheReader{
+		body: body,
+		hv:   hv,
+		w:    w,
+		hash: sha1.New(),
+		log:  log.With("fileID", hv.FileID()),
+	}
+}
+
+func (r *teeCacheReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 && r.w != nil {
+		r.hash.Write(p[:n])
+		r.n += n
+		if _, werr := r.w.Write(p[:n]); werr != nil {
+			r.log.Errorf("HV, write cache: %s", werr)
+			r.abort()
+		}
+	}
+	if err == io.EOF {
+		r.commit()
+	}
+	return n, err
+}
+
+// Close abort caching if the client went away before EOF
+func (r *teeCacheReader) Close() error {
+	r.abort()
+	return r.body.Close()
+}
+
+func (r *teeCacheReader) commit() {
+	w := r.w
+	if w == nil {
+		return
+	}
+	r.w = nil
+
+	if r.n != r.hv.Size {
+		r.log.Warnf("HV, refuse to cache downloaded file, size mismatch: %v", r.n)
+		w.Abort()
+		return
+	}
+	if sum := hex.EncodeToString(r.hash.Sum(nil)); sum != r.hv.Hash {
+		r.log.Warnf("HV, refuse to cache downloaded file, hash mismatch: %s", sum)
+		w.Abort()
+		return
+	}
+	// don't delay response
+	go func() {
+		if err := w.Commit(); err != nil {
+			r.log.Errorf("HV, failed to cache downloaded file: %s", err)
+			return
+		}
+		r.log.Info("HV, downloaded file cached.")
+	}()
+}
+
+func (r *teeCacheReader) abort() {
+	if r.w == nil {
+		return
+	}
+	if err := r.w.Abort(); err != nil {
+		r.log.Errorf("HV, abort cache: %s", err)
+	}
+	r.w = nil
+}
+
+// randReader n random bytes for speed test, it's bounded by itself, as fasthttp
+//	unwraps *io.LimitedReader and reads the underlying reader until EOF.
+type randReader struct {
+	n int64
+}
+
+func (r *randReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err := rand.Read(p)
+	r.n -= int64(n)
+	return n, err
+}
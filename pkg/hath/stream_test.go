@@ -0,0 +1,42 @@
+package hath
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestTeeCacheReader(t *testing.T) {
+	stor := testStorage(t)
+
+	data, good := testHVData(t)
+	bad := testHVFile(t, 1, len(data))
+
+	for _, hv := range []*HVFile{good, bad} {
+		w, err := stor.CreateHVFile(hv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newTeeCacheReader(io.NopCloser(bytes.NewReader(data)), hv, w, zap.S())
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		if !bytes.Equal(out, data) {
+			t.Fatal("client should receive upstream data")
+		}
+	}
+
+	// commit is async
+	time.Sleep(100 * time.Millisecond)
+	if _, err := stor.GetHVFile(good); err != nil {
+		t.Fatalf("verified file should be cached: %v", err)
+	}
+	if _, err := stor.GetHVFile(bad); err != ErrNotFound {
+		t.Fatalf("mismatched file should not be cached: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package hath
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// autoResumeRetry first delay to retry failed auto resume, it's doubled
+	//	after each failure up to autoResumeMaxRetry.
+	autoResumeRetry    = 30 * time.Second
+	autoResumeMaxRetry = 10 * time.Minute
+)
+
+// ErrInvalidSuspendDuration duration must be positive
+var ErrInvalidSuspendDuration = errors.New("invalid suspend duration")
+
+// suspension client is taken out of rotation until resumed
+type suspension struct {
+	sync.Mutex
+
+	// op serializes suspend and resume, it's held during rpc calls while
+	//	the state lock isn't, so readers are not blocked by retries.
+	op sync.Mutex
+
+	until time.Time
+	timer *time.Timer
+	// gen increased by each suspend, auto resume of stale timer is ignored
+	gen uint64
+}
+
+// Suspend notify server to stop routing requests to this client,
+//	it will be resumed automatically after duration.
+func (c *Client) Suspend(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ErrInvalidSuspendDuration
+	}
+	defer c.suspension.op.Unlock()
+	c.suspension.op.Lock()
+
+	if _, err := c.RPCRequestContext(ctx, ActionClientSuspend, ""); err != nil {
+		return errors.Wrap(err, "notify suspend")
+	}
+
+	c.suspension.Lock()
+	if c.suspension.timer != nil {
+		c.suspension.timer.Stop()
+	}
+	c.suspension.gen++
+	gen := c.suspension.gen
+	c.suspension.until = time.Now().Add(d)
+	c.armResumeLocked(gen, d, autoResumeRetry)
+	until := c.suspension.until
+	c.suspension.Unlock()
+
+	zap.S().Infof("Suspend, client suspended until: %s", until)
+	return nil
+}
+
+// Resume notify server this client can receive requests again.
+func (c *Client) Resume(ctx context.Context) error {
+	defer c.suspension.op.Unlock()
+	c.suspension.op.Lock()
+
+	return c.resumeLocked(ctx)
+}
+
+// armResumeLocked state lock must be held, failed auto resume is retried with backoff
+//	until it succeeds, client is resumed manually or suspended again.
+func (c *Client) armResumeLocked(gen uint64, d, retry time.Duration) {
+	c.suspension.timer = time.AfterFunc(d, func() {
+		err := c.autoResume(gen)
+		if err == nil || c.ctx.Err() != nil {
+			return
+		}
+		zap.S().Errorf("Suspend, auto resume failed, retry in %s: %s", retry, err)
+
+		next := retry * 2
+		if next > autoResumeMaxRetry {
+			next = autoResumeMaxRetry
+		}
+		defer c.suspension.Unlock()
+		c.suspension.Lock()
+		if c.suspension.gen == gen && !c.suspension.until.IsZero() {
+			c.armResumeLocked(gen, retry, next)
+		}
+	})
+}
+
+// autoResume timer might fire while suspension is being extended,
+//	it's skipped if another suspend happened after the timer was set.
+func (c *Client) autoResume(gen uint64) error {
+	defer c.suspension.op.Unlock()
+	c.suspension.op.Lock()
+
+	c.suspension.Lock()
+	stale := c.suspension.gen != gen
+	c.suspension.Unlock()
+	if stale {
+		return nil
+	}
+	return c.resumeLocked(c.ctx)
+}
+
+// resumeLocked op lock must be held
+func (c *Client) resumeLocked(ctx context.Context) error {
+	if c.SuspendedUntil().IsZero() {
+		return nil
+	}
+	if _, err := c.RPCRequestContext(ctx, ActionClientResume, ""); err != nil {
+		return errors.Wrap(err, "notify resume")
+	}
+
+	c.suspension.Lock()
+	if c.suspension.timer != nil {
+		c.suspension.timer.Stop()
+		c.suspension.timer = nil
+	}
+	c.suspension.until = time.Time{}
+	c.suspension.Unlock()
+
+	zap.S().Info("Suspend, client resumed.")
+	return nil
+}
+
+// SuspendedUntil zero time if client is not suspended
+func (c *Client) SuspendedUntil() time.Time {
+	defer c.suspension.Unlock()
+	c.suspension.Lock()
+
+	return c.suspension.until
+}
@@ -0,0 +1,92 @@
+package hath
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_SuspendResume(t *testing.T) {
+	c, fake := testClient(t)
+	ctx := context.Background()
+
+	if err := c.Suspend(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if c.SuspendedUntil().IsZero() || fake.Calls(string(ActionClientSuspend)) != 1 {
+		t.Fatal("client should be suspended")
+	}
+	if err := c.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !c.SuspendedUntil().IsZero() || fake.Calls(string(ActionClientResume)) != 1 {
+		t.Fatal("client should be resumed")
+	}
+	// not suspended, no-op
+	if err := c.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.Calls(string(ActionClientResume)); n != 1 {
+		t.Fatalf("resume should be skipped, calls: %v", n)
+	}
+}
+
+func TestClient_SuspendAutoResume(t *testing.T) {
+	c, fake := testClient(t)
+	ctx := context.Background()
+
+	if err := c.Suspend(ctx, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !c.SuspendedUntil().IsZero() || fake.Calls(string(ActionClientResume)) != 1 {
+		t.Fatal("client should be resumed automatically")
+	}
+
+	// timer of extended suspension fires late, it must not resume
+	if err := c.Suspend(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	c.suspension.Lock()
+	gen := c.suspension.gen
+	c.suspension.Unlock()
+	if err := c.Suspend(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.autoResume(gen); err != nil {
+		t.Fatal(err)
+	}
+	if c.SuspendedUntil().IsZero() || fake.Calls(string(ActionClientResume)) != 1 {
+		t.Fatal("stale timer should not resume extended suspension")
+	}
+}
+
+func TestClient_SuspendAutoResumeRetry(t *testing.T) {
+	c, fake := testClient(t)
+	// server fails twice
+	fails := int32(2)
+	fake.Handle(string(ActionClientResume), func(add string) string {
+		if atomic.AddInt32(&fails, -1) >= 0 {
+			return "FAIL"
+		}
+		return "OK\n"
+	})
+
+	if err := c.Suspend(context.Background(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// fire timer early with short retry delay
+	c.suspension.Lock()
+	c.suspension.timer.Stop()
+	c.armResumeLocked(c.suspension.gen, time.Millisecond, 5*time.Millisecond)
+	c.suspension.Unlock()
+
+	time.Sleep(200 * time.Millisecond)
+	if !c.SuspendedUntil().IsZero() {
+		t.Fatal("failed auto resume should be retried")
+	}
+	if n := fake.Calls(string(ActionClientResume)); n != 3 {
+		t.Fatalf("unexpected resume calls: %v", n)
+	}
+}
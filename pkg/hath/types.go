@@ -1,5 +1,7 @@
 package hath
 
+import "time"
+
 const (
 	ClientVersion = "1.6.1#go"
 	// ClientBuild is among other things used by the server to determine the client's capabilities. any forks should use the build number as an indication of compatibility with mainline, rather than an internal build number.
@@ -8,6 +10,26 @@ const (
 	MaxKeyTimeDrift   = 300
 	MaxConnectionBase = 20
 	TCPPacketSize     = 1460
+	// MaxConnectionCap connection limit when bandwidth is unlimited
+	MaxConnectionCap = 1000
+	// MaxSpeedTestSize max bytes of a speed test response
+	MaxSpeedTestSize = 100 * 1024 * 1024
+	// rpcMaxAttempts attempts of a rpc call, including the first one
+	rpcMaxAttempts = 3
+	// rpcRetryBaseDelay backoff delay of first retry, doubled each time
+	rpcRetryBaseDelay = 2 * time.Second
+	// rpcDemoteDuration failing rpc host is skipped for a while
+	rpcDemoteDuration = 5 * time.Minute
+	// certCheckInterval interval to check expiry of tls cert
+	certCheckInterval = time.Hour
+	// certRenewBefore tls cert is renewed when it expires within this duration
+	certRenewBefore = 72 * time.Hour
+	// certRenewAttempts attempts of a renewal, including the first one
+	certRenewAttempts = 5
+	// certRetryBaseDelay backoff delay of first renewal retry, doubled each time
+	certRetryBaseDelay = time.Minute
+	// OverloadNotifyInterval min interval between overload notifications
+	OverloadNotifyInterval = 30 * time.Second
 
 	ClientRPCProtocol   = "http"
 	ClientRPCHost       = "rpc.hentaiathome.net"
@@ -44,6 +66,7 @@ var (
 	ActionClientStop           Action = "client_stop"
 	ActionStillAlive           Action = "still_alive"
 	ActionStaticRangeFetch     Action = "srfetch"
+	ActionDownloaderQueue      Action = "fetchqueue"
 	ActionDownloaderFetch      Action = "dlfetch"
 	ActionDownloaderFailreport Action = "dlfails"
 	ActionOverload             Action = "overload"
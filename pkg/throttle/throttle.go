@@ -0,0 +1,115 @@
+// Package throttle token bucket limiter for outbound bandwidth.
+package throttle
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// ChunkSize max bytes a reader takes from bucket at once, small chunks
+//	interleave concurrent readers, so each connection gets a fair share.
+const ChunkSize = 16 * 1024
+
+// Bucket token bucket shared by all connections, tokens are bytes.
+//	Waiters are served in order of reservation, tokens can go negative,
+//	later callers wait for the debt to be paid.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket rate in bytes per second, <= 0 means unlimited, bucket starts full.
+func NewBucket(rate int64) *Bucket {
+	return &Bucket{
+		rate:   rate,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// SetRate update rate, burst is one second of rate.
+func (b *Bucket) SetRate(rate int64) {
+	defer b.mu.Unlock()
+	b.mu.Lock()
+
+	b.refill(time.Now())
+	b.rate = rate
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+}
+
+// Rate ...
+func (b *Bucket) Rate() int64 {
+	defer b.mu.Unlock()
+	b.mu.Lock()
+
+	return b.rate
+}
+
+func (b *Bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	b.last = now
+	if b.rate <= 0 {
+		return
+	}
+	b.tokens += elapsed.Seconds() * float64(b.rate)
+	if b.tokens > float64(b.rate) {
+		b.tokens = float64(b.rate)
+	}
+}
+
+// reserve take n tokens, returns how long caller should wait
+func (b *Bucket) reserve(n int) time.Duration {
+	defer b.mu.Unlock()
+	b.mu.Lock()
+
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// Wait block until n bytes can be sent
+func (b *Bucket) Wait(n int) {
+	if d := b.reserve(n); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Reader throttle reads from r
+func (b *Bucket) Reader(r io.Reader) io.Reader {
+	return &reader{r: r, b: b}
+}
+
+type reader struct {
+	r io.Reader
+	b *Bucket
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > ChunkSize {
+		p = p[:ChunkSize]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.b.Wait(n)
+	}
+	return n, err
+}
+
+// Close close underlying reader if possible
+func (r *reader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
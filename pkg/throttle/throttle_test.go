@@ -0,0 +1,41 @@
+package throttle
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBucket_Reader(t *testing.T) {
+	b := NewBucket(64 * 1024)
+	// drain burst
+	b.Wait(64 * 1024)
+
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(io.Discard, b.Reader(bytes.NewReader(make([]byte, 16*1024))))
+		}()
+	}
+	wg.Wait()
+
+	// 64KiB at 64KiB/s
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("unexpected elapsed time: %s", elapsed)
+	}
+}
+
+func TestBucket_Unlimited(t *testing.T) {
+	b := NewBucket(0)
+
+	start := time.Now()
+	io.Copy(io.Discard, b.Reader(bytes.NewReader(make([]byte, 10*1024*1024))))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("unlimited bucket should not throttle: %s", elapsed)
+	}
+}
@@ -89,4 +89,34 @@
 	 item.deadline = edf.currentTime + 1.0/float64(item.weight)
 	 heap.Fix(&edf.items, 0)
 	 return item.item
- }
\ No newline at end of file
+ }
+ 
+ func (edf *edfWrr) Update(item interface{}, weight int64) {
+	 edf.lock.Lock()
+	 defer edf.lock.Unlock()
+	 for i, entry := range edf.items {
+		 if entry.item == item {
+			 if entry.weight == weight {
+				 return
+			 }
+			 // rescale time left to the deadline, restarting it would put
+			 // the heaviest item ahead of all others on every update
+			 remaining := entry.deadline - edf.currentTime
+			 entry.deadline = edf.currentTime + remaining*float64(entry.weight)/float64(weight)
+			 entry.weight = weight
+			 heap.Fix(&edf.items, i)
+			 return
+		 }
+	 }
+ }
+ 
+ func (edf *edfWrr) Remove(item interface{}) {
+	 edf.lock.Lock()
+	 defer edf.lock.Unlock()
+	 for i, entry := range edf.items {
+		 if entry.item == item {
+			 heap.Remove(&edf.items, i)
+			 return
+		 }
+	 }
+ }
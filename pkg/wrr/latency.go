@@ -0,0 +1,152 @@
+package wrr
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// latencySmoothing weight of new sample in moving average
+	latencySmoothing = 0.3
+	// weightScale base weights are scaled, so small weights can be adjusted finely
+	weightScale = 100
+	// maxFailurePenalty weight is halved for each consecutive failure, up to this times
+	maxFailurePenalty = 6
+)
+
+// Latency WRR adjusts weights of items by observed latency and failures,
+//	effective weight = base weight * fastest latency / item latency,
+//	then halved for each consecutive failure.
+type Latency struct {
+	mu    sync.Mutex
+	wrr   WRR
+	stats map[interface{}]*latencyStat
+}
+
+type latencyStat struct {
+	base     int64
+	latency  time.Duration
+	failures int
+	// weight effective weight set to wrr
+	weight int64
+}
+
+// NewLatency creates latency aware WRR backed by EDF.
+func NewLatency() *Latency {
+	return &Latency{
+		wrr:   NewEDF(),
+		stats: make(map[interface{}]*latencyStat),
+	}
+}
+
+// Add adds an item with base weight, it's updated if item exists.
+func (l *Latency) Add(item interface{}, weight int64) {
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	if st, ok := l.stats[item]; ok {
+		st.base = weight
+		l.reweight()
+		return
+	}
+	l.stats[item] = &latencyStat{base: weight, weight: weight * weightScale}
+	l.wrr.Add(item, weight*weightScale)
+	l.reweight()
+}
+
+// Next returns the next picked item.
+func (l *Latency) Next() interface{} {
+	return l.wrr.Next()
+}
+
+// Update changes base weight of an item.
+func (l *Latency) Update(item interface{}, weight int64) {
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	if st, ok := l.stats[item]; ok {
+		st.base = weight
+		l.reweight()
+	}
+}
+
+// Remove removes an item and its stats.
+func (l *Latency) Remove(item interface{}) {
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	delete(l.stats, item)
+	l.wrr.Remove(item)
+	l.reweight()
+}
+
+// Observe records result of a call to item, latency is ignored if failed.
+func (l *Latency) Observe(item interface{}, latency time.Duration, failed bool) {
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	st, ok := l.stats[item]
+	if !ok {
+		return
+	}
+	if failed {
+		if st.failures < maxFailurePenalty {
+			st.failures++
+		}
+	} else {
+		st.failures = 0
+		if st.latency == 0 {
+			st.latency = latency
+		} else {
+			st.latency = time.Duration(float64(st.latency)*(1-latencySmoothing) + float64(latency)*latencySmoothing)
+		}
+	}
+	l.reweight()
+}
+
+// Weight effective weight of item, 0 if it doesn't exist.
+func (l *Latency) Weight(item interface{}) int64 {
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	st, ok := l.stats[item]
+	if !ok {
+		return 0
+	}
+	return l.weight(st, l.fastest())
+}
+
+// reweight items are compared to the fastest one, so weights are updated together,
+//	only changed weights are passed to wrr.
+func (l *Latency) reweight() {
+	fastest := l.fastest()
+	for item, st := range l.stats {
+		if w := l.weight(st, fastest); w != st.weight {
+			st.weight = w
+			l.wrr.Update(item, w)
+		}
+	}
+}
+
+func (l *Latency) fastest() time.Duration {
+	var fastest time.Duration
+	for _, st := range l.stats {
+		if st.latency > 0 && (fastest == 0 || st.latency < fastest) {
+			fastest = st.latency
+		}
+	}
+	return fastest
+}
+
+func (l *Latency) weight(st *latencyStat, fastest time.Duration) int64 {
+	w := st.base * weightScale
+	// items without samples are treated as the fastest one
+	if st.latency > 0 && fastest > 0 {
+		w = int64(float64(w) * float64(fastest) / float64(st.latency))
+	}
+	w >>= st.failures
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
@@ -0,0 +1,96 @@
+package wrr
+
+import (
+	"testing"
+	"time"
+)
+
+func pickCount(w WRR, n int) map[interface{}]int {
+	counts := make(map[interface{}]int)
+	for i := 0; i < n; i++ {
+		counts[w.Next()]++
+	}
+	return counts
+}
+
+func TestEDF_UpdateRemove(t *testing.T) {
+	w := NewEDF()
+	w.Add("a", 1)
+	w.Add("b", 1)
+
+	w.Update("a", 3)
+	if counts := pickCount(w, 400); counts["a"] != 300 || counts["b"] != 100 {
+		t.Fatalf("unexpected picks: %v", counts)
+	}
+
+	w.Remove("a")
+	if counts := pickCount(w, 10); counts["b"] != 10 {
+		t.Fatalf("removed item should not be picked: %v", counts)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	l := NewLatency()
+	l.Add("fast", 10)
+	l.Add("slow", 10)
+	l.Add("failing", 10)
+
+	for i := 0; i < 10; i++ {
+		l.Observe("fast", 100*time.Millisecond, false)
+		l.Observe("slow", 400*time.Millisecond, false)
+		l.Observe("failing", 100*time.Millisecond, false)
+	}
+	l.Observe("failing", 0, true)
+	l.Observe("failing", 0, true)
+
+	if fast, slow := l.Weight("fast"), l.Weight("slow"); fast != 1000 || slow != 250 {
+		t.Fatalf("unexpected weights, fast: %v, slow: %v", fast, slow)
+	}
+	if w := l.Weight("failing"); w != 250 {
+		t.Fatalf("failures should halve weight: %v", w)
+	}
+
+	counts := pickCount(l, 1500)
+	if counts["fast"] <= counts["slow"] || counts["fast"] <= counts["failing"] {
+		t.Fatalf("fast item should be picked most: %v", counts)
+	}
+
+	// recovered
+	l.Observe("failing", 100*time.Millisecond, false)
+	if w := l.Weight("failing"); w != 1000 {
+		t.Fatalf("success should reset failures: %v", w)
+	}
+
+	l.Remove("fast")
+	if w := l.Weight("slow"); w != 250 {
+		t.Fatalf("weights are relative to fastest item: %v", w)
+	}
+	if counts := pickCount(l, 100); counts["fast"] != 0 {
+		t.Fatalf("removed item should not be picked: %v", counts)
+	}
+}
+
+func TestLatency_ObserveEachPick(t *testing.T) {
+	latencies := map[interface{}]time.Duration{
+		"a": 100 * time.Millisecond,
+		"b": 100 * time.Millisecond,
+		"c": 200 * time.Millisecond,
+	}
+	l := NewLatency()
+	for _, item := range []string{"a", "b", "c"} {
+		l.Add(item, 10)
+	}
+
+	// like rpc client, every pick is followed by an observation
+	counts := make(map[interface{}]int)
+	for i := 0; i < 500; i++ {
+		item := l.Next()
+		counts[item]++
+		l.Observe(item, latencies[item], false)
+	}
+
+	// weights converge to 2:2:1
+	if counts["a"] < 150 || counts["b"] < 150 || counts["c"] < 60 || counts["c"] > 140 {
+		t.Fatalf("unexpected picks: %v", counts)
+	}
+}
@@ -29,4 +29,8 @@ type WRR interface {
 	//
 	// Add and Next need to be thread safe.
 	Next() interface{}
+	// Update changes weight of an item, it's no-op if item doesn't exist.
+	Update(item interface{}, weight int64)
+	// Remove removes an item from the WRR set.
+	Remove(item interface{})
 }
\ No newline at end of file
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mayocream/hath-go/pkg/hath"
+	hServer "github.com/mayocream/hath-go/server"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// AdminServer local admin api, it must not be exposed to public network.
+type AdminServer struct {
+	hath *hServer.Hath
+	// public server to report load of
+	public *Server
+}
+
+// NewAdminServer ...
+func NewAdminServer(hath *hServer.Hath, public *Server) *AdminServer {
+	return &AdminServer{
+		hath:   hath,
+		public: public,
+	}
+}
+
+// app routes of admin api
+func (s *AdminServer) app() *fiber.App {
+	srv := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+	})
+	srv.Get("/status", s.statusHandler)
+	srv.Post("/refresh/settings", s.refreshSettingsHandler)
+	srv.Post("/refresh/certs", s.refreshCertsHandler)
+	srv.Post("/suspend", s.suspendHandler)
+	srv.Post("/resume", s.resumeHandler)
+	srv.Post("/cache/purge", s.purgeCacheHandler)
+	return srv
+}
+
+// Serve ...
+func (s *AdminServer) Serve(ctx context.Context) error {
+	srv := s.app()
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown()
+	}()
+
+	zap.S().Infof("Admin server will serve at: %s", s.hath.Config.AdminAddr)
+	return srv.Listen(s.hath.Config.AdminAddr)
+}
+
+// statusHandler GET /status
+func (s *AdminServer) statusHandler(c *fiber.Ctx) error {
+	load := s.public.load
+	return c.JSON(fiber.Map{
+		"hath": s.hath.Status(),
+		"load": fiber.Map{
+			"active_connections": load.ActiveConnections(),
+			"max_connections":    s.hath.HC.RemoteSettings.MaxConnections(),
+			"latency":            load.Latency(),
+			"bandwidth":          load.Bandwidth(),
+		},
+	})
+}
+
+// refreshSettingsHandler POST /refresh/settings
+func (s *AdminServer) refreshSettingsHandler(c *fiber.Ctx) error {
+	if err := s.hath.RefreshSettings(c.Context()); err != nil {
+		return fiber.NewError(http.StatusBadGateway, err.Error())
+	}
+	return c.JSON(s.hath.Status().RemoteSettings)
+}
+
+// refreshCertsHandler POST /refresh/certs
+func (s *AdminServer) refreshCertsHandler(c *fiber.Ctx) error {
+	if err := s.hath.RefreshCertificate(c.Context()); err != nil {
+		return fiber.NewError(http.StatusBadGateway, err.Error())
+	}
+	return c.JSON(s.hath.Status().Certificate)
+}
+
+// purgeCacheHandler POST /cache/purge, all cached files are deleted.
+func (s *AdminServer) purgeCacheHandler(c *fiber.Ctx) error {
+	purged, err := s.hath.PurgeCache(c.Context())
+	if errors.Is(err, hath.ErrReconcileRunning) {
+		return fiber.NewError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{
+		"purged": purged,
+	})
+}
+
+// suspendHandler POST /suspend?duration=1h
+func (s *AdminServer) suspendHandler(c *fiber.Ctx) error {
+	d := s.hath.Config.SuspendDuration
+	if v := c.Query("duration"); v != "" {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return fiber.NewError(http.StatusBadRequest, "invalid duration")
+		}
+	}
+
+	err := s.hath.HC.Suspend(c.Context(), d)
+	if errors.Is(err, hath.ErrInvalidSuspendDuration) {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(http.StatusBadGateway, err.Error())
+	}
+	return c.JSON(fiber.Map{
+		"suspended_until": s.hath.HC.SuspendedUntil(),
+	})
+}
+
+// resumeHandler POST /resume
+func (s *AdminServer) resumeHandler(c *fiber.Ctx) error {
+	if err := s.hath.HC.Resume(c.Context()); err != nil {
+		return fiber.NewError(http.StatusBadGateway, err.Error())
+	}
+	return c.JSON(fiber.Map{
+		"suspended_until": s.hath.HC.SuspendedUntil(),
+	})
+}
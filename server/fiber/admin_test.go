@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mayocream/hath-go/pkg/hath"
+	"github.com/mayocream/hath-go/pkg/hath/hathtest"
+	hServer "github.com/mayocream/hath-go/server"
+)
+
+func testAdminServer(t *testing.T) (*AdminServer, *hathtest.Server) {
+	fake := hathtest.NewServer("12345", "abcdefghijklmnopqrst")
+	t.Cleanup(fake.Close)
+
+	var config hServer.Config
+	config.Settings = hath.Settings{ClientID: fake.ClientID, ClientKey: fake.ClientKey}
+	config.DBFile = filepath.Join(t.TempDir(), "hv.ldb")
+	config.SuspendDuration = time.Hour
+	s, err := hath.NewServer(context.Background(), config.Config, hath.WithRPCBaseURL(fake.RPCURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	h := &hServer.Hath{Server: s, Config: config}
+	return NewAdminServer(h, NewServer(h)), fake
+}
+
+// testAdminCall decodes json response into v
+func testAdminCall(t *testing.T, s *AdminServer, method, target string, v interface{}) {
+	resp, err := s.app().Test(httptest.NewRequest(method, target, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s, unexpected status: %v", method, target, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminServer_Status(t *testing.T) {
+	s, _ := testAdminServer(t)
+
+	var status struct {
+		Hath struct {
+			ClientID   string                 `json:"client_id"`
+			StartedAt  time.Time              `json:"started_at"`
+			Downloader *hath.DownloadProgress `json:"downloader"`
+		} `json:"hath"`
+		Load struct {
+			ActiveConnections *int64 `json:"active_connections"`
+		} `json:"load"`
+	}
+	testAdminCall(t, s, "GET", "/status", &status)
+	if status.Hath.ClientID != "12345" || status.Hath.StartedAt.IsZero() {
+		t.Fatalf("unexpected status: %+v", status.Hath)
+	}
+	if status.Hath.Downloader == nil {
+		t.Fatal("downloader progress should be reported")
+	}
+	if status.Load.ActiveConnections == nil {
+		t.Fatal("load should be reported")
+	}
+}
+
+func TestAdminServer_SuspendResume(t *testing.T) {
+	s, fake := testAdminServer(t)
+
+	var resp struct {
+		SuspendedUntil time.Time `json:"suspended_until"`
+	}
+	testAdminCall(t, s, "POST", "/suspend?duration=30m", &resp)
+	if d := time.Until(resp.SuspendedUntil); d <= 0 || d > 30*time.Minute {
+		t.Fatalf("unexpected suspension: %s", resp.SuspendedUntil)
+	}
+	if fake.Calls(string(hath.ActionClientSuspend)) != 1 {
+		t.Fatal("server should be notified of suspension")
+	}
+
+	testAdminCall(t, s, "POST", "/resume", &resp)
+	if !resp.SuspendedUntil.IsZero() || fake.Calls(string(hath.ActionClientResume)) != 1 {
+		t.Fatalf("client should be resumed, suspended until: %s", resp.SuspendedUntil)
+	}
+
+	for _, d := range []string{"soon", "-1h"} {
+		res, err := s.app().Test(httptest.NewRequest("POST", "/suspend?duration="+d, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("invalid duration %s should be rejected, status: %v", d, res.StatusCode)
+		}
+	}
+}
+
+func TestAdminServer_Refresh(t *testing.T) {
+	s, fake := testAdminServer(t)
+
+	fake.SetSetting("port", "8443")
+	var settings hath.RemoteSettingsStatus
+	testAdminCall(t, s, "POST", "/refresh/settings", &settings)
+	if settings.ServerPort != 8443 {
+		t.Fatalf("settings should be refreshed, port: %v", settings.ServerPort)
+	}
+
+	var cert hath.CertificateStatus
+	testAdminCall(t, s, "POST", "/refresh/certs", &cert)
+	if !cert.Valid || fake.Calls(string(hath.ActionGetCertificate)) != 1 {
+		t.Fatalf("cert should be refreshed: %+v", cert)
+	}
+
+	// rpc failure is reported as bad gateway
+	fake.Handle(string(hath.ActionGetCertificate), func(add string) string { return "FAIL" })
+	res, err := s.app().Test(httptest.NewRequest("POST", "/refresh/certs", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadGateway {
+		t.Fatalf("unexpected status: %v", res.StatusCode)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// floodMaxHits connections allowed in a burst from one ip, one hit decays per second
+	floodMaxHits = 10
+	// floodBanDuration ban duration of flooding ip
+	floodBanDuration = time.Minute
+	// floodCleanupInterval idle entries are removed
+	floodCleanupInterval = time.Minute
+)
+
+// floodEntry decaying connection counter of one ip
+type floodEntry struct {
+	hits        float64
+	lastHit     time.Time
+	bannedUntil time.Time
+}
+
+// limitListener rejects connections from flooding ips and connections over global limit,
+//	like the Java client's flood control.
+type limitListener struct {
+	net.Listener
+
+	// exempt rpc servers and loopback are never limited
+	exempt func(ip string) bool
+	// active number of accepted connections
+	active func() int64
+	// maxConns global connection limit
+	maxConns func() int64
+
+	// now clock, it's replaced in tests
+	now func() time.Time
+
+	mu          sync.Mutex
+	entries     map[string]*floodEntry
+	lastCleanup time.Time
+}
+
+func newLimitListener(ln net.Listener, exempt func(ip string) bool, active, maxConns func() int64) *limitListener {
+	return &limitListener{
+		Listener:    ln,
+		exempt:      exempt,
+		active:      active,
+		maxConns:    maxConns,
+		now:         time.Now,
+		entries:     make(map[string]*floodEntry),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Accept returns next allowed connection, rejected ones are closed immediately.
+func (ln *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if reason := ln.reject(conn); reason != "" {
+			zap.S().With("ip", conn.RemoteAddr().String()).Debugf("Limit, connection rejected: %s", reason)
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+func (ln *limitListener) reject(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ln.exempt(ip.String()) {
+		return ""
+	}
+
+	if max := ln.maxConns(); max > 0 && ln.active() >= max {
+		return "too many connections"
+	}
+
+	now := ln.now()
+	defer ln.mu.Unlock()
+	ln.mu.Lock()
+
+	if now.Sub(ln.lastCleanup) > floodCleanupInterval {
+		ln.cleanup(now)
+	}
+
+	e, ok := ln.entries[ip.String()]
+	if !ok {
+		e = &floodEntry{lastHit: now}
+		ln.entries[ip.String()] = e
+	}
+	if now.Before(e.bannedUntil) {
+		return "banned"
+	}
+
+	e.hits -= now.Sub(e.lastHit).Seconds()
+	if e.hits < 0 {
+		e.hits = 0
+	}
+	e.hits++
+	e.lastHit = now
+	if e.hits > floodMaxHits {
+		e.bannedUntil = now.Add(floodBanDuration)
+		e.hits = 0
+		zap.S().With("ip", ip.String()).Warnf("Limit, flood detected, banned for %s.", floodBanDuration)
+		return "flood"
+	}
+	return ""
+}
+
+// cleanup remove entries decayed and not banned
+func (ln *limitListener) cleanup(now time.Time) {
+	for ip, e := range ln.entries {
+		if now.After(e.bannedUntil) && now.Sub(e.lastHit).Seconds() > floodMaxHits {
+			delete(ln.entries, ip)
+		}
+	}
+	ln.lastCleanup = now
+}
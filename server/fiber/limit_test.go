@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// addrConn conn with remote address only
+type addrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func testConn(ip string) net.Conn {
+	return &addrConn{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}}
+}
+
+func TestLimitListener_Flood(t *testing.T) {
+	now := time.Unix(1000, 0)
+	ln := newLimitListener(nil, func(ip string) bool { return ip == "192.0.2.1" },
+		func() int64 { return 0 }, func() int64 { return 0 })
+	ln.now = func() time.Time { return now }
+	ln.lastCleanup = now
+
+	// burst within limit
+	for i := 0; i < floodMaxHits; i++ {
+		if reason := ln.reject(testConn("198.51.100.1")); reason != "" {
+			t.Fatalf("hit %v should pass: %s", i, reason)
+		}
+	}
+	if reason := ln.reject(testConn("198.51.100.1")); reason != "flood" {
+		t.Fatalf("burst over limit should be banned: %q", reason)
+	}
+	now = now.Add(floodBanDuration / 2)
+	if reason := ln.reject(testConn("198.51.100.1")); reason != "banned" {
+		t.Fatalf("ip should still be banned: %q", reason)
+	}
+	// other ips are not affected
+	if reason := ln.reject(testConn("198.51.100.2")); reason != "" {
+		t.Fatalf("other ip should pass: %s", reason)
+	}
+
+	// ban expired
+	now = now.Add(floodBanDuration)
+	if reason := ln.reject(testConn("198.51.100.1")); reason != "" {
+		t.Fatalf("ban should expire: %s", reason)
+	}
+
+	// hits decay one per second
+	for i := 0; i < 3*floodMaxHits; i++ {
+		now = now.Add(time.Second)
+		if reason := ln.reject(testConn("198.51.100.3")); reason != "" {
+			t.Fatalf("hits should decay: %s", reason)
+		}
+	}
+
+	// idle entries are cleaned up
+	now = now.Add(floodCleanupInterval + floodBanDuration)
+	ln.reject(testConn("198.51.100.4"))
+	if _, ok := ln.entries["198.51.100.1"]; ok || len(ln.entries) != 1 {
+		t.Fatalf("idle entries should be removed: %v", len(ln.entries))
+	}
+}
+
+func TestLimitListener_Exempt(t *testing.T) {
+	ln := newLimitListener(nil, func(ip string) bool { return ip == "192.0.2.1" },
+		func() int64 { return 100 }, func() int64 { return 10 })
+
+	for i := 0; i < 3*floodMaxHits; i++ {
+		for _, ip := range []string{"192.0.2.1", "127.0.0.1", "::1"} {
+			if reason := ln.reject(testConn(ip)); reason != "" {
+				t.Fatalf("%s should be exempt: %s", ip, reason)
+			}
+		}
+	}
+}
+
+func TestLimitListener_MaxConnections(t *testing.T) {
+	active := int64(0)
+	ln := newLimitListener(nil, func(ip string) bool { return false },
+		func() int64 { return active }, func() int64 { return 2 })
+
+	active = 1
+	if reason := ln.reject(testConn("198.51.100.1")); reason != "" {
+		t.Fatalf("connection under limit should pass: %s", reason)
+	}
+	active = 2
+	if reason := ln.reject(testConn("198.51.100.2")); reason != "too many connections" {
+		t.Fatalf("connection over limit should be rejected: %q", reason)
+	}
+}
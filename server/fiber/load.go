@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	hServer "github.com/mayocream/hath-go/server"
+	"go.uber.org/zap"
+)
+
+// latencySmoothing weight of the newest sample in latency moving average
+const latencySmoothing = 0.1
+
+// requestStartKey local of request start time, it's set by load middleware
+const requestStartKey = "load.start"
+
+// loadMonitor tracks active connections, response latency and outbound bandwidth,
+//	notifies h@h server when this node is saturated.
+type loadMonitor struct {
+	conf   hServer.OverloadConf
+	notify func(ctx context.Context) (bool, error)
+	// ctx notifications are cancelled on shutdown
+	ctx context.Context
+
+	active   int64
+	bytesOut int64
+	// bandwidth outbound bytes of last second
+	bandwidth int64
+
+	mu      sync.Mutex
+	latency time.Duration
+}
+
+func newLoadMonitor(conf hServer.OverloadConf, notify func(ctx context.Context) (bool, error)) *loadMonitor {
+	return &loadMonitor{
+		conf:   conf,
+		notify: notify,
+		ctx:    context.Background(),
+	}
+}
+
+// start must be called before accepting connections
+func (m *loadMonitor) start(ctx context.Context) {
+	m.ctx = ctx
+	go m.run(ctx)
+}
+
+// run sample bandwidth and check thresholds every second
+func (m *loadMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		atomic.StoreInt64(&m.bandwidth, atomic.SwapInt64(&m.bytesOut, 0))
+		m.check()
+	}
+}
+
+// check notify server if any threshold is exceeded
+func (m *loadMonitor) check() {
+	var reason string
+	switch {
+	case m.conf.OverloadMaxConnections > 0 && m.ActiveConnections() > m.conf.OverloadMaxConnections:
+		reason = "connections"
+	case m.conf.OverloadMaxLatency > 0 && m.Latency() > m.conf.OverloadMaxLatency:
+		reason = "latency"
+	case m.conf.OverloadMaxBandwidth > 0 && m.Bandwidth() > m.conf.OverloadMaxBandwidth:
+		reason = "bandwidth"
+	default:
+		return
+	}
+
+	go func() {
+		sent, err := m.notify(m.ctx)
+		if err != nil {
+			zap.S().Errorf("Overload, notify server: %s", err)
+			return
+		}
+		if sent {
+			zap.S().Warnf("Overload, %s threshold exceeded, connections: %v, latency: %s, bandwidth: %v bytes/s.",
+				reason, m.ActiveConnections(), m.Latency(), m.Bandwidth())
+		}
+	}()
+}
+
+// ActiveConnections ...
+func (m *loadMonitor) ActiveConnections() int64 {
+	return atomic.LoadInt64(&m.active)
+}
+
+// Bandwidth outbound bytes per second
+func (m *loadMonitor) Bandwidth() int64 {
+	return atomic.LoadInt64(&m.bandwidth)
+}
+
+// Latency moving average of request processing time
+func (m *loadMonitor) Latency() time.Duration {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+
+	return m.latency
+}
+
+// middleware measure request processing time, streamed body is sent after
+//	handler returns, its request is measured when the stream is closed.
+func (m *loadMonitor) middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	c.Locals(requestStartKey, start)
+	err := c.Next()
+	observeResponse(c, err)
+
+	if !c.Response().IsBodyStream() {
+		m.observeLatency(time.Since(start))
+	}
+	return err
+}
+
+func (m *loadMonitor) observeLatency(elapsed time.Duration) {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+
+	if m.latency == 0 {
+		m.latency = elapsed
+	} else {
+		m.latency = time.Duration(float64(m.latency)*(1-latencySmoothing) + float64(elapsed)*latencySmoothing)
+	}
+}
+
+// countReader count bytes sent to clients, latency since request start
+//	is observed on close, start is zero if it's not measured.
+func (m *loadMonitor) countReader(r io.Reader, start time.Time) io.Reader {
+	return &countingReader{r: r, n: &m.bytesOut, m: m, start: start}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+
+	m     *loadMonitor
+	start time.Time
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddInt64(cr.n, int64(n))
+	servedBytes.Add(float64(n))
+	return n, err
+}
+
+// Close close underlying reader if possible, body stream is closed by fasthttp.
+func (cr *countingReader) Close() error {
+	if !cr.start.IsZero() {
+		cr.m.observeLatency(time.Since(cr.start))
+		cr.start = time.Time{}
+	}
+	if c, ok := cr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// listener track active connections
+func (m *loadMonitor) listener(ln net.Listener) net.Listener {
+	return &trackListener{Listener: ln, m: m}
+}
+
+type trackListener struct {
+	net.Listener
+	m *loadMonitor
+}
+
+func (ln *trackListener) Accept() (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if atomic.AddInt64(&ln.m.active, 1) > ln.m.conf.OverloadMaxConnections && ln.m.conf.OverloadMaxConnections > 0 {
+		ln.m.check()
+	}
+	return &trackConn{Conn: conn, m: ln.m}, nil
+}
+
+type trackConn struct {
+	net.Conn
+	m    *loadMonitor
+	once sync.Once
+}
+
+func (c *trackConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.m.active, -1)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	hServer "github.com/mayocream/hath-go/server"
+)
+
+// slowReader sleeps before each read
+type slowReader struct {
+	io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.Reader.Read(p)
+}
+
+func TestLoadMonitor_StreamLatency(t *testing.T) {
+	m := newLoadMonitor(hServer.OverloadConf{}, nil)
+	app := fiber.New()
+	app.Use(m.middleware)
+	app.Get("/", func(c *fiber.Ctx) error {
+		start, _ := c.Locals(requestStartKey).(time.Time)
+		body := &slowReader{Reader: strings.NewReader("hath"), delay: 50 * time.Millisecond}
+		return c.SendStream(m.countReader(body, start), 4)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	if l := m.Latency(); l < 50*time.Millisecond {
+		t.Fatalf("latency should include body transfer: %s", l)
+	}
+}
+
+func TestLoadMonitor_Check(t *testing.T) {
+	notified := make(chan struct{}, 1)
+	m := newLoadMonitor(hServer.OverloadConf{
+		OverloadMaxConnections: 2,
+		OverloadMaxLatency:     time.Second,
+		OverloadMaxBandwidth:   1000,
+	}, func(ctx context.Context) (bool, error) {
+		notified <- struct{}{}
+		return true, nil
+	})
+	expect := func(name string, overloaded bool) {
+		t.Helper()
+		m.check()
+		select {
+		case <-notified:
+			if !overloaded {
+				t.Fatalf("%s: unexpected notification", name)
+			}
+		case <-time.After(50 * time.Millisecond):
+			if overloaded {
+				t.Fatalf("%s: expected notification", name)
+			}
+		}
+	}
+
+	expect("idle", false)
+
+	atomic.StoreInt64(&m.active, 3)
+	expect("connections", true)
+	atomic.StoreInt64(&m.active, 0)
+
+	m.observeLatency(2 * time.Second)
+	expect("latency", true)
+	m.mu.Lock()
+	m.latency = 0
+	m.mu.Unlock()
+
+	atomic.StoreInt64(&m.bandwidth, 2000)
+	expect("bandwidth", true)
+}
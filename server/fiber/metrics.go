@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	hServer "github.com/mayocream/hath-go/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"go.uber.org/zap"
+)
+
+var (
+	servedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "hath_served_bytes_total",
+		Help: "Bytes of file content sent to clients.",
+	})
+	httpResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hath_http_responses_total",
+		Help: "HTTP responses by status code.",
+	}, []string{"code"})
+)
+
+// MetricsServer local Prometheus metrics endpoint, it must not be exposed to public network.
+type MetricsServer struct {
+	hath *hServer.Hath
+}
+
+// NewMetricsServer ...
+func NewMetricsServer(hath *hServer.Hath) *MetricsServer {
+	return &MetricsServer{
+		hath: hath,
+	}
+}
+
+// Serve ...
+func (s *MetricsServer) Serve(ctx context.Context) error {
+	srv := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+	})
+	srv.Get("/metrics", s.metricsHandler)
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown()
+	}()
+
+	zap.S().Infof("Metrics server will serve at: %s", s.hath.Config.MetricsAddr)
+	return srv.Listen(s.hath.Config.MetricsAddr)
+}
+
+// metricsHandler GET /metrics
+func (s *MetricsServer) metricsHandler(c *fiber.Ctx) error {
+	promHandler(c.Context())
+	return nil
+}
+
+// promHandler default registry in Prometheus exposition format
+var promHandler = fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler())
+
+// observeResponse count response of status code, errors are not written
+//	to response yet, they are mapped the same way as fiber error handler.
+func observeResponse(c *fiber.Ctx, err error) {
+	code := c.Response().StatusCode()
+	if err != nil {
+		code = fiber.StatusInternalServerError
+		if e, ok := err.(*fiber.Error); ok {
+			code = e.Code
+		}
+	}
+	httpResponses.WithLabelValues(strconv.Itoa(code)).Inc()
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMetricsServer_Handler(t *testing.T) {
+	httpResponses.WithLabelValues("200").Inc()
+	servedBytes.Add(4)
+
+	app := fiber.New()
+	app.Get("/metrics", (&MetricsServer{}).metricsHandler)
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, s := range []string{`hath_http_responses_total{code="200"}`, "hath_served_bytes_total"} {
+		if !strings.Contains(string(body), s) {
+			t.Fatalf("metric %s not found:\n%s", s, body)
+		}
+	}
+}
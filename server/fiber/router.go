@@ -4,14 +4,17 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/mayocream/hath-go/pkg/hath"
+	"github.com/mayocream/hath-go/pkg/throttle"
 	hServer "github.com/mayocream/hath-go/server"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -19,19 +22,28 @@ import (
 
 // Server ...
 type Server struct {
-	hath *hServer.Hath
+	hath     *hServer.Hath
+	load     *loadMonitor
+	throttle *throttle.Bucket
+	// ctx requests are cancelled on shutdown
+	ctx context.Context
 }
 
 // NewServer ...
 func NewServer(hath *hServer.Hath) *Server {
 	return &Server{
-		hath: hath,
+		hath:     hath,
+		load:     newLoadMonitor(hath.Config.OverloadConf, hath.HC.NotifyOverload),
+		throttle: throttle.NewBucket(hath.ThrottleBytes()),
+		ctx:      context.Background(),
 	}
 }
 
 // Serve ...
 func (s *Server) Serve(ctx context.Context) error {
+	s.ctx = ctx
 	srv := fiber.New()
+	srv.Use(s.load.middleware)
 	srv.All("/h/*", s.hvFileHandler)
 	srv.All("/servercmd/*", s.serverCmdHandler)
 	srv.All("/t/*", s.testHandler)
@@ -43,19 +55,25 @@ func (s *Server) Serve(ctx context.Context) error {
 		srv.Use(logger.New(logConf))
 	}
 
-	tlsConfig, err := s.hath.TLSConfig()
+	tlsConfig, err := s.hath.TLSConfig(ctx)
 	if err != nil {
 		return err
 	}
 
-	zap.S().Info("HTTP Server will serve at: %v", s.hath.Addr())
+	zap.S().Infof("HTTP Server will serve at: %v", s.hath.Addr())
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%v", s.hath.Addr()))
 	if err != nil {
 		return err
 	}
-	ln = tls.NewListener(ln, tlsConfig)
+	// flood control runs before tls handshake
+	hc := s.hath.HC
+	ln = newLimitListener(ln, hc.RPCServers.IsRPCServer, s.load.ActiveConnections, hc.RemoteSettings.MaxConnections)
+	ln = tls.NewListener(s.load.listener(ln), tlsConfig)
 	zap.S().Info("HTTPS Server enabled.")
 
+	s.load.start(ctx)
+	go s.syncThrottle(ctx)
+
 	go func() {
 		<-ctx.Done()
 		zap.S().Info("HTTP server graceful shutdown...")
@@ -75,13 +93,17 @@ func (s *Server) hvFileHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	hv, err := s.hath.HandleHV(split[0], split[1], split[2])
+	// upstream fetch lives until the body has been written or the client is gone
+	ctx, cancel := context.WithCancel(s.ctx)
+	hv, reader, err := s.hath.HandleHV(ctx, split[0], split[1], split[2])
 	if err != nil {
+		cancel()
 		return wrapErr(err)
 	}
 
-	c.Send(hv.Data)
-	return nil
+	c.Set(fiber.HeaderContentType, hv.MIMEType())
+	// reader will be closed after body has been written
+	return s.sendStream(c, &cancelReadCloser{ReadCloser: reader, cancel: cancel}, hv.Size)
 }
 
 func (s *Server) serverCmdHandler(c *fiber.Ctx) error {
@@ -94,7 +116,7 @@ func (s *Server) serverCmdHandler(c *fiber.Ctx) error {
 	}
 
 	ip := c.Context().RemoteIP().String()
-	result, err := s.hath.HandleHathCmd(ip, split[0], split[1], split[2], split[3])
+	result, err := s.hath.HandleHathCmd(s.ctx, ip, split[0], split[1], split[2], split[3])
 	if err != nil {
 		return wrapErr(err)
 	}
@@ -112,13 +134,47 @@ func (s *Server) testHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	result, err := s.hath.HandleTest(split[0], split[1], split[2])
+	reader, size, err := s.hath.HandleTest(split[0], split[1], split[2])
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 
-	c.Send(result)
-	return nil
+	return s.sendStream(c, reader, size)
+}
+
+// cancelReadCloser cancels context of the reader on close
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelReadCloser) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// sendStream throttled and counted response body
+func (s *Server) sendStream(c *fiber.Ctx, reader io.Reader, size int) error {
+	start, _ := c.Locals(requestStartKey).(time.Time)
+	return c.SendStream(s.load.countReader(s.throttle.Reader(reader), start), size)
+}
+
+// syncThrottle remote settings can be changed at runtime
+func (s *Server) syncThrottle(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if rate := s.hath.ThrottleBytes(); rate != s.throttle.Rate() {
+			zap.S().Infof("Throttle, outbound bandwidth limit: %v bytes/s", rate)
+			s.throttle.SetRate(rate)
+		}
+	}
 }
 
 func wrapErr(err error) error {
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"context"
+	"time"
+
 	"github.com/mayocream/hath-go/pkg/hath"
 )
 
@@ -10,19 +13,56 @@ type Config struct {
 
 	Debug    bool   `mapstructure:"debug"`
 	LogLevel string `mapstructure:"log_level"`
+
+	// AdminAddr local admin api listen address, disabled if empty
+	AdminAddr string `mapstructure:"admin_addr"`
+	// SuspendDuration default duration of suspend by signal or admin api
+	SuspendDuration time.Duration `mapstructure:"suspend_duration"`
+	// MetricsAddr local Prometheus metrics listen address, disabled if empty
+	MetricsAddr string `mapstructure:"metrics_addr"`
+
+	OverloadConf `mapstructure:",squash"`
+
+	// ThrottleBytesPerSec outbound bandwidth limit, the lower one of it and
+	//	throttle_bytes remote setting takes effect, 0 means unlimited.
+	ThrottleBytesPerSec int64 `mapstructure:"throttle_bytes_per_sec"`
+}
+
+// ThrottleBytes effective outbound bandwidth limit
+func (h *Hath) ThrottleBytes() int64 {
+	local, remote := h.Config.ThrottleBytesPerSec, h.HC.RemoteSettings.ThrottleBytes()
+	if local <= 0 || (remote > 0 && remote < local) {
+		return remote
+	}
+	return local
+}
+
+// OverloadConf thresholds to notify server this node is saturated, 0 means disabled.
+type OverloadConf struct {
+	// OverloadMaxConnections active connections
+	OverloadMaxConnections int64 `mapstructure:"overload_max_connections"`
+	// OverloadMaxLatency average time to process a request
+	OverloadMaxLatency time.Duration `mapstructure:"overload_max_latency"`
+	// OverloadMaxBandwidth outbound bytes per second
+	OverloadMaxBandwidth int64 `mapstructure:"overload_max_bandwidth"`
 }
 
 // Hath ...
 type Hath struct {
 	*hath.Server
+
+	Config Config
 }
 
-// NewHath ...
-func NewHath(config Config) (*Hath, error) {
+// NewHath ctx cancels startup rpc calls and background jobs
+func NewHath(ctx context.Context, config Config) (*Hath, error) {
 	initLogger(config)
-	s, err := hath.NewServer(config.Config)
+	s, err := hath.NewServer(ctx, config.Config)
 	if err != nil {
 		return nil, err
 	}
-	return &Hath{s}, nil
+	if config.SuspendDuration <= 0 {
+		config.SuspendDuration = time.Hour
+	}
+	return &Hath{Server: s, Config: config}, nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -21,7 +22,7 @@ func init() {
 
 func main() {
 	clientKey := viper.GetString("HATH_CLIENT_KEY")
-	hc, err := hath.NewClient(hath.Settings{
+	hc, err := hath.NewClient(context.Background(), hath.Settings{
 		ClientID:  viper.GetString("HATH_CLIENT_ID"),
 		ClientKey: clientKey,
 	})
@@ -29,7 +30,7 @@ func main() {
 		panic(err)
 	}
 
-	data, err := hc.GetRawPKCS12()
+	data, err := hc.GetRawPKCS12(context.Background())
 	if err != nil {
 		panic(err)
 	}